@@ -0,0 +1,154 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+// AlignmentScoring scores a local alignment: matching steps earn Match, while
+// mismatched steps and gaps cost their penalty, so a block ends where the tests diverge
+type AlignmentScoring struct {
+	Match    float64 `json:"match"`
+	Mismatch float64 `json:"mismatch"` // Penalty for aligning two different steps
+	Gap      float64 `json:"gap"`      // Penalty for skipping a step in one test
+}
+
+// DefaultAlignmentScoring allows a single extra or changed step inside a block of three or more matches
+var DefaultAlignmentScoring = AlignmentScoring{Match: 2, Mismatch: 1, Gap: 1}
+
+// Alignment operations reported in a local alignment
+const (
+	AlignMatch    = "match"
+	AlignMismatch = "mismatch"
+	AlignGapA     = "gap_a" // Step only in test B
+	AlignGapB     = "gap_b" // Step only in test A
+)
+
+// AlignedStep is one column of a local alignment; an index is -1 on the side of a gap
+type AlignedStep struct {
+	Op     string `json:"op"`
+	IndexA int    `json:"index_a"`
+	IndexB int    `json:"index_b"`
+	A      string `json:"a,omitempty"`
+	B      string `json:"b,omitempty"`
+}
+
+// LocalAlignment is the best scoring shared block of two tests.
+// The block covers steps StartA to EndA-1 of test A and StartB to EndB-1 of test B.
+type LocalAlignment struct {
+	Score   float64       `json:"score"`
+	StartA  int           `json:"start_a"`
+	EndA    int           `json:"end_a"`
+	StartB  int           `json:"start_b"`
+	EndB    int           `json:"end_b"`
+	Matches int           `json:"matches"`
+	Steps   []AlignedStep `json:"steps"`
+}
+
+// Align finds the best scoring local alignment of two step sequences (Smith-Waterman)
+func Align(a, b []string, scoring AlignmentScoring) LocalAlignment {
+	m, n := len(a), len(b)
+	dp := make([][]float64, m+1)
+	for i := range dp {
+		dp[i] = make([]float64, n+1)
+	}
+
+	bestI, bestJ := 0, 0
+	for i := 1; i <= m; i++ {
+		for j := 1; j <= n; j++ {
+			diagonal := -scoring.Mismatch
+			if a[i-1] == b[j-1] {
+				diagonal = scoring.Match
+			}
+			score := math.Max(0, dp[i-1][j-1]+diagonal)
+			score = math.Max(score, dp[i-1][j]-scoring.Gap)
+			score = math.Max(score, dp[i][j-1]-scoring.Gap)
+			dp[i][j] = score
+			if score > dp[bestI][bestJ] {
+				bestI, bestJ = i, j
+			}
+		}
+	}
+
+	alignment := LocalAlignment{Score: dp[bestI][bestJ], StartA: bestI, EndA: bestI, StartB: bestJ, EndB: bestJ, Steps: []AlignedStep{}}
+	if alignment.Score == 0 {
+		return alignment // Nothing shared
+	}
+
+	// Trace back from the best cell until the block's score drops to zero
+	var steps []AlignedStep
+	i, j := bestI, bestJ
+	for i > 0 && j > 0 && dp[i][j] > 0 {
+		switch {
+		case a[i-1] == b[j-1] && sameCost(dp[i][j], dp[i-1][j-1]+scoring.Match):
+			steps = append(steps, AlignedStep{Op: AlignMatch, IndexA: i - 1, IndexB: j - 1, A: a[i-1], B: b[j-1]})
+			alignment.Matches++
+			i, j = i-1, j-1
+		case a[i-1] != b[j-1] && sameCost(dp[i][j], dp[i-1][j-1]-scoring.Mismatch):
+			steps = append(steps, AlignedStep{Op: AlignMismatch, IndexA: i - 1, IndexB: j - 1, A: a[i-1], B: b[j-1]})
+			i, j = i-1, j-1
+		case sameCost(dp[i][j], dp[i-1][j]-scoring.Gap):
+			steps = append(steps, AlignedStep{Op: AlignGapB, IndexA: i - 1, IndexB: -1, A: a[i-1]})
+			i--
+		default:
+			steps = append(steps, AlignedStep{Op: AlignGapA, IndexA: -1, IndexB: j - 1, B: b[j-1]})
+			j--
+		}
+	}
+	for left, right := 0, len(steps)-1; left < right; left, right = left+1, right-1 {
+		steps[left], steps[right] = steps[right], steps[left]
+	}
+
+	alignment.StartA, alignment.StartB, alignment.Steps = i, j, steps
+	return alignment
+}
+
+// LocalAlignmentMetric scores a pair by how much of the shorter test its best shared block covers.
+// Its comparisons carry the block as details.
+type LocalAlignmentMetric struct {
+	Scoring AlignmentScoring
+}
+
+func (m LocalAlignmentMetric) Name() string  { return "local_alignment" }
+func (m LocalAlignmentMetric) Label() string { return "Local Alignment" }
+
+func (m LocalAlignmentMetric) Similarity(a, b []string) float64 {
+	similarity, _ := m.SimilarityDetails(a, b)
+	return similarity
+}
+
+// The block score as a fraction of the score of the shorter test matching entirely
+func (m LocalAlignmentMetric) SimilarityDetails(a, b []string) (float64, any) {
+	alignment := Align(a, b, m.Scoring)
+	perfect := m.Scoring.Match * float64(min(len(a), len(b)))
+	if perfect == 0 {
+		return 0.0, alignment // Two empty tests have nothing to compare
+	}
+	return math.Min(1, alignment.Score/perfect), alignment
+}
+
+// Configure reads align_match and the align_mismatch and align_gap penalties from the query
+func (m LocalAlignmentMetric) Configure(query url.Values) (SimilarityMetric, error) {
+	scoring := m.Scoring
+	for key, score := range map[string]*float64{
+		"align_match":    &scoring.Match,
+		"align_mismatch": &scoring.Mismatch,
+		"align_gap":      &scoring.Gap,
+	} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+			return nil, fmt.Errorf("invalid %s %q (expected a non-negative number)", key, value)
+		}
+		*score = parsed
+	}
+	if scoring.Match == 0 {
+		return nil, fmt.Errorf("invalid align_match %q (expected a positive number)", query.Get("align_match"))
+	}
+	return LocalAlignmentMetric{Scoring: scoring}, nil
+}
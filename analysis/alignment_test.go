@@ -0,0 +1,98 @@
+package analysis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+var checkoutBlock = []string{"I open the basket", "I go to checkout", "I enter my address", "I choose delivery", "I pay by card", "I see the confirmation"}
+
+func TestAlign(t *testing.T) {
+	a := append(append([]string{"I am on the home page", "I search for shoes"}, checkoutBlock...), "I log out")
+	b := append(append([]string{"I open my wishlist"}, checkoutBlock[:3]...), "I add a gift note")
+	b = append(append(b, checkoutBlock[3:]...), "I rate the shop", "I close the tab")
+
+	alignment := Align(a, b, DefaultAlignmentScoring)
+
+	// The checkout block is found despite the extra step in B
+	if alignment.Score != 11 || alignment.Matches != 6 {
+		t.Errorf("Expected score 11 with 6 matches, got %v with %d", alignment.Score, alignment.Matches)
+	}
+	if alignment.StartA != 2 || alignment.EndA != 8 || alignment.StartB != 1 || alignment.EndB != 8 {
+		t.Errorf("Expected block A[2:8] B[1:8], got A[%d:%d] B[%d:%d]", alignment.StartA, alignment.EndA, alignment.StartB, alignment.EndB)
+	}
+	var ops []string
+	for _, step := range alignment.Steps {
+		ops = append(ops, step.Op)
+	}
+	expected := []string{AlignMatch, AlignMatch, AlignMatch, AlignGapA, AlignMatch, AlignMatch, AlignMatch}
+	if len(ops) != len(expected) {
+		t.Fatalf("Expected operations %v, got %v", expected, ops)
+	}
+	for k := range expected {
+		if ops[k] != expected[k] {
+			t.Fatalf("Expected operations %v, got %v", expected, ops)
+		}
+	}
+	if gap := alignment.Steps[3]; gap.IndexA != -1 || gap.IndexB != 4 || gap.B != "I add a gift note" {
+		t.Errorf("Unexpected gap: %+v", gap)
+	}
+
+	// Nothing in common gives an empty block
+	if none := Align([]string{"A", "B"}, []string{"C"}, DefaultAlignmentScoring); none.Score != 0 || len(none.Steps) != 0 {
+		t.Errorf("Expected no alignment, got %+v", none)
+	}
+}
+
+func TestLocalAlignmentSimilarity(t *testing.T) {
+	metric := LocalAlignmentMetric{Scoring: DefaultAlignmentScoring}
+
+	tests := []struct {
+		a, b     []string
+		expected float64
+	}{
+		{checkoutBlock, checkoutBlock, 1},
+		// The whole of the shorter test is buried in the longer one
+		{checkoutBlock[1:4], append(append([]string{"X", "Y"}, checkoutBlock...), "Z"), 1},
+		{[]string{"A", "B", "C", "D"}, []string{"A", "B", "X", "Y"}, 0.5},
+		{nil, nil, 0},
+	}
+	for _, test := range tests {
+		if result := metric.Similarity(test.a, test.b); result != test.expected {
+			t.Errorf("Expected %v for %v and %v, got %v", test.expected, test.a, test.b, result)
+		}
+	}
+}
+
+func TestGetSimilarityReportsLocalAlignment(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"scenario"}, "metrics": {"local_alignment"}, "align_mismatch": {"3"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports map[string]struct {
+			Comparisons []struct {
+				Details LocalAlignment `json:"details"`
+			} `json:"comparisons"`
+		} `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// With a high mismatch penalty the different login steps split the scenarios into single step blocks
+	details := res.Reports["local_alignment"].Comparisons[0].Details
+	if details.Matches != 1 || details.StartA != 0 || details.EndA != 1 {
+		t.Errorf("Unexpected alignment: %+v", details)
+	}
+
+	rr = getSimilarityReports(t, url.Values{"directory": {dir}, "metrics": {"local_alignment"}, "align_match": {"0"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got %d", rr.Code)
+	}
+}
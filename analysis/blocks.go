@@ -0,0 +1,253 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-similarity-reports/parsing"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Repeated block defaults
+const (
+	DefaultBlockMinLength = 2
+	DefaultBlockMaxLength = 10
+	DefaultBlockMinCount  = 2
+	DefaultBlockLimit     = 50
+)
+
+// BlockOptions choose which repeated step blocks are reported
+type BlockOptions struct {
+	MinLength int // Fewest steps in a block
+	MaxLength int // Most steps in a block
+	MinCount  int // Fewest occurrences of a block
+	Limit     int // Most blocks reported, 0 reports every block
+}
+
+// BlockLocation is one occurrence of a repeated block
+type BlockLocation struct {
+	Test  string          `json:"test"`
+	Ref   parsing.TestRef `json:"ref"`
+	Index int             `json:"index"` // Position of the block's first step in the test
+}
+
+// RepeatedBlock is a contiguous run of steps that appears more than once across the suite
+type RepeatedBlock struct {
+	Steps       []string        `json:"steps"`
+	Length      int             `json:"length"`
+	Occurrences int             `json:"occurrences"`
+	Tests       int             `json:"tests"` // Number of distinct tests containing the block
+	Locations   []BlockLocation `json:"locations"`
+}
+
+// suffixIndex is a suffix array with its LCP array over a sequence of step ids
+type suffixIndex struct {
+	text []int
+	sa   []int // Start positions of the suffixes in sorted order
+	lcp  []int // lcp[i] is the common prefix length of suffixes sa[i-1] and sa[i]
+}
+
+// Build the suffix array by prefix doubling and the LCP array with Kasai's algorithm
+func newSuffixIndex(text []int) *suffixIndex {
+	n := len(text)
+	index := &suffixIndex{text: text, sa: make([]int, n), lcp: make([]int, n)}
+	rank, next := make([]int, n), make([]int, n)
+	for i := range text {
+		index.sa[i], rank[i] = i, text[i]
+	}
+
+	for k := 1; n > 0; k *= 2 {
+		second := func(i int) int {
+			if i+k < n {
+				return rank[i+k]
+			}
+			return -1 << 62 // A suffix that ends sorts first
+		}
+		sort.Slice(index.sa, func(a, b int) bool {
+			x, y := index.sa[a], index.sa[b]
+			if rank[x] != rank[y] {
+				return rank[x] < rank[y]
+			}
+			return second(x) < second(y)
+		})
+
+		next[index.sa[0]] = 0
+		for i := 1; i < n; i++ {
+			prev, cur := index.sa[i-1], index.sa[i]
+			next[cur] = next[prev]
+			if rank[prev] != rank[cur] || second(prev) != second(cur) {
+				next[cur]++
+			}
+		}
+		copy(rank, next)
+		if rank[index.sa[n-1]] == n-1 {
+			break // Every suffix has a distinct rank
+		}
+	}
+
+	h := 0
+	for i := 0; i < n; i++ {
+		if rank[i] == 0 {
+			h = 0
+			continue
+		}
+		j := index.sa[rank[i]-1]
+		for i+h < n && j+h < n && text[i+h] == text[j+h] {
+			h++
+		}
+		index.lcp[rank[i]] = h
+		if h > 0 {
+			h--
+		}
+	}
+	return index
+}
+
+// FindRepeatedBlocks lists the step blocks that occur at least opts.MinCount times, most widespread first.
+// Only closed blocks are reported: a block is skipped when a longer block within MaxLength always surrounds it.
+func FindRepeatedBlocks(tests []parsing.Test, corpus [][]string, opts BlockOptions) []RepeatedBlock {
+	// Concatenate the tests as step ids, ending each with its own negative separator so blocks never span tests
+	ids := make(map[string]int)
+	var steps []string
+	var text, owner, offset []int
+	for t, test := range corpus {
+		for i, step := range test {
+			id, found := ids[step]
+			if !found {
+				id = len(steps)
+				ids[step] = id
+				steps = append(steps, step)
+			}
+			text, owner, offset = append(text, id), append(owner, t), append(offset, i)
+		}
+		text, owner, offset = append(text, -(t+1)), append(owner, t), append(offset, len(test))
+	}
+	index := newSuffixIndex(text)
+
+	blocks := []RepeatedBlock{}
+	for length := opts.MinLength; length <= opts.MaxLength; length++ {
+		repeated := false // Longer blocks only occur where a block of this length does
+		for start := 0; start < len(index.sa); {
+			// Suffixes sharing their first length steps are adjacent in the suffix array
+			end, extends := start, true
+			for end+1 < len(index.sa) && index.lcp[end+1] >= length {
+				end++
+				extends = extends && index.lcp[end] > length
+			}
+			group := index.sa[start : end+1]
+			start = end + 1
+			if len(group) < opts.MinCount || len(group) < 2 {
+				continue
+			}
+			repeated = true
+
+			// Not closed when every occurrence continues, or is preceded, by the same step
+			if length < opts.MaxLength {
+				if extends {
+					continue
+				}
+				preceded := true
+				for _, position := range group {
+					if position == 0 || text[position-1] < 0 || text[position-1] != text[group[0]-1] {
+						preceded = false
+						break
+					}
+				}
+				if preceded {
+					continue
+				}
+			}
+
+			positions := append([]int(nil), group...)
+			sort.Ints(positions)
+			block := RepeatedBlock{Length: length, Occurrences: len(positions)}
+			for _, id := range text[positions[0] : positions[0]+length] {
+				block.Steps = append(block.Steps, steps[id])
+			}
+			seen := make(map[int]bool)
+			for _, position := range positions {
+				t := owner[position]
+				seen[t] = true
+				block.Locations = append(block.Locations, BlockLocation{Test: tests[t].Name, Ref: tests[t].Ref, Index: offset[position]})
+			}
+			block.Tests = len(seen)
+			blocks = append(blocks, block)
+		}
+		if !repeated {
+			break
+		}
+	}
+
+	sort.SliceStable(blocks, func(a, b int) bool {
+		x, y := blocks[a], blocks[b]
+		switch {
+		case x.Tests != y.Tests:
+			return x.Tests > y.Tests
+		case x.Occurrences != y.Occurrences:
+			return x.Occurrences > y.Occurrences
+		case x.Length != y.Length:
+			return x.Length > y.Length
+		}
+		return x.Locations[0].Test < y.Locations[0].Test
+	})
+	if opts.Limit > 0 && len(blocks) > opts.Limit {
+		blocks = blocks[:opts.Limit]
+	}
+	return blocks
+}
+
+// Read min_length, max_length, min_count and limit from the query
+func blockOptionsFromQuery(query url.Values) (BlockOptions, error) {
+	opts := BlockOptions{MinLength: DefaultBlockMinLength, MaxLength: DefaultBlockMaxLength, MinCount: DefaultBlockMinCount, Limit: DefaultBlockLimit}
+	for _, param := range []struct {
+		key    string
+		target *int
+		least  int
+	}{
+		{"min_length", &opts.MinLength, 1},
+		{"max_length", &opts.MaxLength, 1},
+		{"min_count", &opts.MinCount, 2},
+		{"limit", &opts.Limit, 0},
+	} {
+		value := query.Get(param.key)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < param.least {
+			return opts, fmt.Errorf("invalid %s %q (expected an integer of at least %d)", param.key, value, param.least)
+		}
+		*param.target = parsed
+	}
+	if opts.MaxLength < opts.MinLength {
+		return opts, fmt.Errorf("max_length %d is below min_length %d", opts.MaxLength, opts.MinLength)
+	}
+	return opts, nil
+}
+
+// Endpoint to list the step blocks repeated across the suite, candidates for a domain step or a Background
+func GetRepeatedStepBlocks(w http.ResponseWriter, r *http.Request) {
+	opts, err := blockOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tests, diagnostics, ok := loadTests(w, r)
+	if !ok {
+		return
+	}
+
+	// With normalize= blocks that only differ in their parameters count as the same block
+	response := struct {
+		Blocks      []RepeatedBlock      `json:"blocks"`
+		Diagnostics []parsing.Diagnostic `json:"diagnostics"`
+	}{
+		Blocks:      FindRepeatedBlocks(tests, normalizedSteps(tests), opts),
+		Diagnostics: diagnostics,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,135 @@
+package analysis
+
+import (
+	"encoding/json"
+	"go-similarity-reports/parsing"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+)
+
+func TestNewSuffixIndex(t *testing.T) {
+	// "banana" as ids: b=1 a=0 n=2
+	index := newSuffixIndex([]int{1, 0, 2, 0, 2, 0})
+
+	expectedSA := []int{5, 3, 1, 0, 4, 2}
+	expectedLCP := []int{0, 1, 3, 0, 0, 2}
+	for i := range expectedSA {
+		if index.sa[i] != expectedSA[i] || index.lcp[i] != expectedLCP[i] {
+			t.Fatalf("Expected suffix array %v with LCP %v, got %v with %v", expectedSA, expectedLCP, index.sa, index.lcp)
+		}
+	}
+
+	// The result matches sorting the suffixes directly
+	text := []int{3, 1, 4, 1, 5, 9, 2, 6, 5, 3, 5, 8, 9, 7, 9, 3, -1, 3, 1, 4, -2}
+	naive := make([]int, len(text))
+	for i := range naive {
+		naive[i] = i
+	}
+	sort.Slice(naive, func(a, b int) bool {
+		x, y := text[naive[a]:], text[naive[b]:]
+		for k := 0; k < len(x) && k < len(y); k++ {
+			if x[k] != y[k] {
+				return x[k] < y[k]
+			}
+		}
+		return len(x) < len(y)
+	})
+	index = newSuffixIndex(text)
+	for i := range naive {
+		if index.sa[i] != naive[i] {
+			t.Fatalf("Expected suffix array %v, got %v", naive, index.sa)
+		}
+	}
+}
+
+func TestFindRepeatedBlocks(t *testing.T) {
+	corpus := [][]string{
+		append(append([]string{"I am on the home page"}, checkoutBlock[:4]...), "I log out"),
+		append([]string{"I search for shoes"}, checkoutBlock[:4]...),
+		append(append([]string{}, checkoutBlock[:2]...), "I log out", "I am on the home page"),
+		// The block repeats within a single test
+		{"I open the basket", "I go to checkout", "I open the basket", "I go to checkout"},
+	}
+	tests := make([]parsing.Test, len(corpus))
+	for i := range corpus {
+		tests[i] = parsing.Test{Name: string(rune('A' + i))}
+	}
+
+	blocks := FindRepeatedBlocks(tests, corpus, BlockOptions{MinLength: 2, MaxLength: 10, MinCount: 2})
+
+	// The opening pair is in every test, the four step block only in the first two; its shorter prefixes
+	// always extend to the full block, and nothing spans the end of one test into the next
+	if len(blocks) != 2 {
+		t.Fatalf("Expected 2 blocks, got %+v", blocks)
+	}
+	pair, block := blocks[0], blocks[1]
+	if pair.Length != 2 || pair.Occurrences != 5 || pair.Tests != 4 || pair.Steps[0] != "I open the basket" {
+		t.Errorf("Unexpected first block: %+v", pair)
+	}
+	if block.Length != 4 || block.Occurrences != 2 || block.Tests != 2 || block.Steps[3] != "I choose delivery" {
+		t.Errorf("Unexpected second block: %+v", block)
+	}
+	if loc := block.Locations[1]; loc.Test != "B" || loc.Index != 1 {
+		t.Errorf("Expected the second occurrence at step 1 of B, got %+v", loc)
+	}
+
+	// Capping the length reports the capped blocks in place of the longer one
+	blocks = FindRepeatedBlocks(tests, corpus, BlockOptions{MinLength: 2, MaxLength: 3, MinCount: 2})
+	if len(blocks) != 3 || blocks[0].Length != 2 || blocks[1].Length != 3 || blocks[2].Length != 3 {
+		t.Errorf("Expected the opening pair and two three step blocks, got %+v", blocks)
+	}
+
+	// The search stops once nothing repeats, however long the blocks may be
+	if blocks := FindRepeatedBlocks(tests, corpus, BlockOptions{MinLength: 2, MaxLength: 1 << 30, MinCount: 2}); len(blocks) != 2 {
+		t.Errorf("Expected the same 2 blocks without a practical length cap, got %+v", blocks)
+	}
+
+	if blocks := FindRepeatedBlocks(tests, corpus, BlockOptions{MinLength: 2, MaxLength: 10, MinCount: 2, Limit: 1}); len(blocks) != 1 {
+		t.Errorf("Expected the limit to keep 1 block, got %d", len(blocks))
+	}
+}
+
+func TestGetRepeatedStepBlocks(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature, "search.feature": searchFeature})
+
+	tests := []struct {
+		query    url.Values
+		expected int // Number of blocks
+	}{
+		// The login scenarios differ in their middle step, so no two steps in a row are shared word for word
+		{url.Values{"directory": {dir}, "granularity": {"scenario"}}, 0},
+		// Once normalised the login scenarios are identical
+		{url.Values{"directory": {dir}, "granularity": {"scenario"}, "normalize": {"strings"}}, 1},
+		{url.Values{"directory": {dir}, "granularity": {"scenario"}, "normalize": {"strings"}, "min_count": {"3"}}, 0},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/api/similarity-reports/blocks?"+test.query.Encode(), nil)
+		rr := httptest.NewRecorder()
+		GetRepeatedStepBlocks(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var res struct {
+			Blocks []RepeatedBlock `json:"blocks"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		if len(res.Blocks) != test.expected {
+			t.Errorf("Expected %d blocks for %v, got %+v", test.expected, test.query, res.Blocks)
+		}
+	}
+
+	for _, query := range []string{"min_count=1", "min_length=4&max_length=3", "limit=x"} {
+		req := httptest.NewRequest("GET", "/api/similarity-reports/blocks?directory="+dir+"&"+query, nil)
+		rr := httptest.NewRecorder()
+		GetRepeatedStepBlocks(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code 400 for %s, got %d", query, rr.Code)
+		}
+	}
+}
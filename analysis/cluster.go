@@ -0,0 +1,343 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-similarity-reports/parsing"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Linkage decides how similar a merged cluster is to the others
+type Linkage string
+
+const (
+	LinkageSingle   Linkage = "single"   // Similarity of the closest members
+	LinkageComplete Linkage = "complete" // Similarity of the furthest members
+	LinkageAverage  Linkage = "average"  // Mean similarity over every pair of members
+)
+
+// Clustering defaults: average linkage over the Jaccard index, cut at 0.5
+const (
+	DefaultClusterMetric    = "jaccard"
+	DefaultClusterLinkage   = LinkageAverage
+	DefaultClusterThreshold = 0.5
+)
+
+// Merge joins clusters A and B, identified by dendrogram node id, into cluster ID
+type Merge struct {
+	ID         int     `json:"id"`
+	A          int     `json:"a"`
+	B          int     `json:"b"`
+	Similarity float64 `json:"similarity"`
+	Size       int     `json:"size"`
+}
+
+// Agglomerate merges the two most similar clusters until one is left.
+// Leaves are numbered 0..n-1 after the rows of the similarity matrix, and merge k creates node n+k.
+func Agglomerate(similarity [][]float64, linkage Linkage) []Merge {
+	n := len(similarity)
+	if n < 2 {
+		return []Merge{}
+	}
+
+	// Working copy of the matrix, updated in place as clusters merge
+	sim := make([][]float64, n)
+	for i := range sim {
+		sim[i] = append([]float64(nil), similarity[i]...)
+	}
+	active := make([]bool, n)
+	node := make([]int, n) // Dendrogram node currently held by each row
+	size := make([]int, n)
+	for i := range active {
+		active[i], node[i], size[i] = true, i, 1
+	}
+
+	// Most similar neighbour of every row, so each merge only rescans the rows it affected
+	best := make([]int, n)
+	findBest := func(r int) {
+		best[r] = -1
+		for c := 0; c < n; c++ {
+			if c != r && active[c] && (best[r] < 0 || sim[r][c] > sim[r][best[r]]) {
+				best[r] = c
+			}
+		}
+	}
+	for r := range best {
+		findBest(r)
+	}
+
+	merges := make([]Merge, 0, n-1)
+	for len(merges) < n-1 {
+		i := -1
+		for r := 0; r < n; r++ {
+			if active[r] && (i < 0 || sim[r][best[r]] > sim[i][best[i]]) {
+				i = r
+			}
+		}
+		j := best[i]
+		if j < i {
+			i, j = j, i
+		}
+
+		merges = append(merges, Merge{ID: n + len(merges), A: node[i], B: node[j], Similarity: sim[i][j], Size: size[i] + size[j]})
+
+		// Row i becomes the merged cluster, row j is retired
+		for r := 0; r < n; r++ {
+			if !active[r] || r == i || r == j {
+				continue
+			}
+			var merged float64
+			switch linkage {
+			case LinkageSingle:
+				merged = math.Max(sim[r][i], sim[r][j])
+			case LinkageComplete:
+				merged = math.Min(sim[r][i], sim[r][j])
+			default:
+				merged = (float64(size[i])*sim[r][i] + float64(size[j])*sim[r][j]) / float64(size[i]+size[j])
+			}
+			sim[r][i], sim[i][r] = merged, merged
+		}
+		active[j] = false
+		node[i], size[i] = merges[len(merges)-1].ID, size[i]+size[j]
+
+		findBest(i)
+		for r := 0; r < n; r++ {
+			if !active[r] || r == i {
+				continue
+			}
+			if best[r] == i || best[r] == j {
+				findBest(r)
+			} else if sim[r][i] > sim[r][best[r]] {
+				best[r] = i
+			}
+		}
+	}
+	return merges
+}
+
+// Cut groups the leaves joined by merges at or above the threshold, returning the cluster index of every leaf
+func Cut(n int, merges []Merge, threshold float64) []int {
+	parent := make([]int, n+len(merges))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(x int) int {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+	for _, merge := range merges {
+		if merge.Similarity >= threshold {
+			parent[find(merge.A)] = merge.ID
+			parent[find(merge.B)] = merge.ID
+		}
+	}
+
+	labels := make([]int, n)
+	index := make(map[int]int)
+	for leaf := range labels {
+		root := find(leaf)
+		if _, found := index[root]; !found {
+			index[root] = len(index)
+		}
+		labels[leaf] = index[root]
+	}
+	return labels
+}
+
+// ClusterMember is a test in a duplicate group
+type ClusterMember struct {
+	Test             string          `json:"test"`
+	Ref              parsing.TestRef `json:"ref"`
+	MedoidSimilarity float64         `json:"medoid_similarity"`
+}
+
+// Cluster is a group of tests that are similar enough to merge
+type Cluster struct {
+	Size     int             `json:"size"`
+	Medoid   string          `json:"medoid"` // Member with the highest total similarity to the others
+	Cohesion float64         `json:"cohesion"`
+	Members  []ClusterMember `json:"members"`
+}
+
+// DendrogramNode is a node of the merge tree; leaves are tests and inner nodes are merges
+type DendrogramNode struct {
+	ID         int               `json:"id"`
+	Test       string            `json:"test,omitempty"`
+	Ref        *parsing.TestRef  `json:"ref,omitempty"`
+	Similarity float64           `json:"similarity"` // Similarity at which the children merged, 1 for leaves
+	Size       int               `json:"size"`
+	Children   []*DendrogramNode `json:"children,omitempty"`
+}
+
+// Groups of two or more tests that share a cluster label, largest first
+func buildClusters(tests []parsing.Test, similarity [][]float64, labels []int) []Cluster {
+	groups := make(map[int][]int)
+	for leaf, label := range labels {
+		groups[label] = append(groups[label], leaf)
+	}
+
+	clusters := []Cluster{}
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+
+		medoid, bestTotal, total := members[0], -1.0, 0.0
+		for _, a := range members {
+			sum := 0.0
+			for _, b := range members {
+				if a != b {
+					sum += similarity[a][b]
+				}
+			}
+			total += sum
+			if sum > bestTotal {
+				medoid, bestTotal = a, sum
+			}
+		}
+
+		cluster := Cluster{
+			Size:     len(members),
+			Medoid:   tests[medoid].Name,
+			Cohesion: total / float64(len(members)*(len(members)-1)),
+		}
+		for _, member := range members {
+			medoidSimilarity := 1.0
+			if member != medoid {
+				medoidSimilarity = similarity[medoid][member]
+			}
+			cluster.Members = append(cluster.Members, ClusterMember{Test: tests[member].Name, Ref: tests[member].Ref, MedoidSimilarity: medoidSimilarity})
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	sort.Slice(clusters, func(a, b int) bool {
+		if clusters[a].Size != clusters[b].Size {
+			return clusters[a].Size > clusters[b].Size
+		}
+		return clusters[a].Medoid < clusters[b].Medoid
+	})
+	return clusters
+}
+
+// Link the merges into a tree, returning its root
+func buildDendrogram(tests []parsing.Test, merges []Merge) *DendrogramNode {
+	nodes := make([]*DendrogramNode, len(tests)+len(merges))
+	for i := range tests {
+		nodes[i] = &DendrogramNode{ID: i, Test: tests[i].Name, Ref: &tests[i].Ref, Similarity: 1, Size: 1}
+	}
+	for _, merge := range merges {
+		nodes[merge.ID] = &DendrogramNode{ID: merge.ID, Similarity: merge.Similarity, Size: merge.Size, Children: []*DendrogramNode{nodes[merge.A], nodes[merge.B]}}
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[len(nodes)-1]
+}
+
+// Read metric, linkage and threshold from the query
+func clusterOptionsFromQuery(query url.Values) (SimilarityMetric, Linkage, float64, error) {
+	name := query.Get("metric")
+	if name == "" {
+		name = DefaultClusterMetric
+	}
+	metric, found := LookupMetric(name)
+	if !found {
+		return nil, "", 0, fmt.Errorf("unknown metric %q", name)
+	}
+	if configurable, ok := metric.(ConfigurableMetric); ok {
+		var err error
+		if metric, err = configurable.Configure(query); err != nil {
+			return nil, "", 0, err
+		}
+	}
+
+	linkage := Linkage(query.Get("linkage"))
+	switch linkage {
+	case "":
+		linkage = DefaultClusterLinkage
+	case LinkageSingle, LinkageComplete, LinkageAverage:
+	default:
+		return nil, "", 0, fmt.Errorf("unknown linkage %q (expected single, complete or average)", linkage)
+	}
+
+	threshold := DefaultClusterThreshold
+	if value := query.Get("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			return nil, "", 0, fmt.Errorf("invalid threshold %q (expected a number between 0 and 1)", value)
+		}
+		threshold = parsed
+	}
+	return metric, linkage, threshold, nil
+}
+
+// Endpoint to group similar tests with agglomerative clustering.
+// Every pair is compared, so memory grows with the square of the number of tests.
+func GetSimilarityClusters(w http.ResponseWriter, r *http.Request) {
+	metric, linkage, threshold, err := clusterOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	workers, err := workersFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tests, diagnostics, ok := loadTests(w, r)
+	if !ok {
+		return
+	}
+	metric = fitMetrics([]SimilarityMetric{metric}, tests)[0]
+
+	similarity := make([][]float64, len(tests))
+	for i := range similarity {
+		similarity[i] = make([]float64, len(tests))
+		similarity[i][i] = 1
+	}
+	err = comparePairs(r.Context(), tests, allPairs(len(tests)), []SimilarityMetric{metric}, workers, func(i, j int, entries []ComparisonEntry) error {
+		similarity[i][j], similarity[j][i] = entries[0].Similarity, entries[0].Similarity
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Similarity computation cancelled: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	merges := Agglomerate(similarity, linkage)
+	clusters := buildClusters(tests, similarity, Cut(len(tests), merges, threshold))
+	clustered := 0
+	for _, cluster := range clusters {
+		clustered += cluster.Size
+	}
+
+	response := struct {
+		Metric      string               `json:"metric"`
+		Linkage     Linkage              `json:"linkage"`
+		Threshold   float64              `json:"threshold"`
+		Clusters    []Cluster            `json:"clusters"`
+		Unclustered int                  `json:"unclustered"` // Tests not similar enough to any other
+		Dendrogram  *DendrogramNode      `json:"dendrogram"`
+		Diagnostics []parsing.Diagnostic `json:"diagnostics"`
+	}{
+		Metric:      metric.Name(),
+		Linkage:     linkage,
+		Threshold:   threshold,
+		Clusters:    clusters,
+		Unclustered: len(tests) - clustered,
+		Dendrogram:  buildDendrogram(tests, merges),
+		Diagnostics: diagnostics,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,116 @@
+package analysis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// Two groups, {0, 1, 2} and {3, 4}, where 2 is only close to 1
+var clusterMatrix = [][]float64{
+	{1.0, 0.9, 0.2, 0.1, 0.0},
+	{0.9, 1.0, 0.6, 0.1, 0.0},
+	{0.2, 0.6, 1.0, 0.0, 0.1},
+	{0.1, 0.1, 0.0, 1.0, 0.8},
+	{0.0, 0.0, 0.1, 0.8, 1.0},
+}
+
+func TestAgglomerate(t *testing.T) {
+	tests := []struct {
+		linkage  Linkage
+		expected []Merge
+	}{
+		{LinkageSingle, []Merge{{5, 0, 1, 0.9, 2}, {6, 3, 4, 0.8, 2}, {7, 5, 2, 0.6, 3}, {8, 7, 6, 0.1, 5}}},
+		{LinkageComplete, []Merge{{5, 0, 1, 0.9, 2}, {6, 3, 4, 0.8, 2}, {7, 5, 2, 0.2, 3}, {8, 7, 6, 0.0, 5}}},
+		{LinkageAverage, []Merge{{5, 0, 1, 0.9, 2}, {6, 3, 4, 0.8, 2}, {7, 5, 2, 0.4, 3}, {8, 7, 6, 0.05, 5}}},
+	}
+
+	for _, test := range tests {
+		merges := Agglomerate(clusterMatrix, test.linkage)
+		if len(merges) != len(test.expected) {
+			t.Fatalf("%s: expected %d merges, got %d", test.linkage, len(test.expected), len(merges))
+		}
+		for k, merge := range merges {
+			expected := test.expected[k]
+			if merge.ID != expected.ID || merge.A != expected.A || merge.B != expected.B || merge.Size != expected.Size || !closeTo(merge.Similarity, expected.Similarity) {
+				t.Errorf("%s: merge %d expected %+v, got %+v", test.linkage, k, expected, merge)
+			}
+		}
+	}
+}
+
+func TestCut(t *testing.T) {
+	merges := Agglomerate(clusterMatrix, LinkageSingle)
+
+	tests := []struct {
+		threshold float64
+		expected  []int
+	}{
+		{0.95, []int{0, 1, 2, 3, 4}},
+		{0.7, []int{0, 0, 1, 2, 2}},
+		{0.5, []int{0, 0, 0, 1, 1}},
+		{0, []int{0, 0, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		labels := Cut(len(clusterMatrix), merges, test.threshold)
+		for k := range labels {
+			if labels[k] != test.expected[k] {
+				t.Errorf("Threshold %v: expected %v, got %v", test.threshold, test.expected, labels)
+				break
+			}
+		}
+	}
+}
+
+func TestGetSimilarityClusters(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{
+		"login.feature":  loginFeature,
+		"copy.feature":   loginFeature,
+		"search.feature": searchFeature,
+	})
+
+	req := httptest.NewRequest("GET", "/api/similarity-reports/clusters?"+url.Values{"directory": {dir}, "linkage": {"complete"}, "threshold": {"0.9"}}.Encode(), nil)
+	rr := httptest.NewRecorder()
+	GetSimilarityClusters(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Metric      string          `json:"metric"`
+		Clusters    []Cluster       `json:"clusters"`
+		Unclustered int             `json:"unclustered"`
+		Dendrogram  *DendrogramNode `json:"dendrogram"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// The copied feature forms the only group
+	if res.Metric != DefaultClusterMetric || len(res.Clusters) != 1 || res.Unclustered != 1 {
+		t.Fatalf("Unexpected clusters: %+v", res)
+	}
+	cluster := res.Clusters[0]
+	if cluster.Size != 2 || cluster.Medoid != "copy.feature" || cluster.Cohesion != 1 || cluster.Members[1].Test != "login.feature" {
+		t.Errorf("Unexpected cluster: %+v", cluster)
+	}
+	if res.Dendrogram == nil || res.Dendrogram.Size != 3 || len(res.Dendrogram.Children) != 2 {
+		t.Errorf("Unexpected dendrogram: %+v", res.Dendrogram)
+	}
+
+	for _, query := range []url.Values{{"metric": {"nope"}}, {"linkage": {"ward"}}, {"threshold": {"-1"}}} {
+		query.Set("directory", dir)
+		req := httptest.NewRequest("GET", "/api/similarity-reports/clusters?"+query.Encode(), nil)
+		rr := httptest.NewRecorder()
+		GetSimilarityClusters(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code 400 for %v, got %d", query, rr.Code)
+		}
+	}
+}
+
+func closeTo(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
@@ -0,0 +1,209 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-similarity-reports/parsing"
+	"math"
+	"net/http"
+	"sort"
+)
+
+// Containment modes of the redundant tests report
+const (
+	ContainmentSubsequence = "subsequence" // Every step, in the same order
+	ContainmentSet         = "set"         // Every distinct step, in any order
+)
+
+// SubsequenceContainment is the fraction of A's steps that appear in B in the same order
+func SubsequenceContainment(testA, testB []string) float64 {
+	if len(testA) == 0 {
+		return 0.0 // An empty test has nothing to contain
+	}
+	return float64(LCS(testA, testB)) / float64(len(testA))
+}
+
+// SetContainment is the fraction of A's distinct steps that B also uses
+func SetContainment(testA, testB []string) float64 {
+	setA, setB := stepCounts(testA), stepCounts(testB)
+	if len(setA) == 0 {
+		return 0.0 // An empty test has nothing to contain
+	}
+	shared := 0
+	for step := range setA {
+		if setB[step] > 0 {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(setA))
+}
+
+// OverlapCoefficient is the number of shared distinct steps over the distinct steps of the smaller test
+func OverlapCoefficient(setA, setB []string) float64 {
+	a, b := stepCounts(setA), stepCounts(setB)
+	if len(a) == 0 || len(b) == 0 {
+		return 0.0 // An empty test has nothing to compare
+	}
+	shared := 0
+	for step := range a {
+		if b[step] > 0 {
+			shared++
+		}
+	}
+	return float64(shared) / float64(min(len(a), len(b)))
+}
+
+// Containment gives both directions of an asymmetric metric
+type Containment struct {
+	AInB float64 `json:"a_in_b"`
+	BInA float64 `json:"b_in_a"`
+}
+
+// ContainmentMetric scores a pair by how much of the shorter test the longer one contains,
+// so a short test buried in a long one scores high. Its comparisons carry both directions as details.
+type ContainmentMetric struct {
+	name, label string
+	containment func(a, b []string) float64
+}
+
+// NewContainmentMetric wraps an asymmetric containment function, the fraction of its first test found in the second
+func NewContainmentMetric(name, label string, containment func(a, b []string) float64) ContainmentMetric {
+	return ContainmentMetric{name: name, label: label, containment: containment}
+}
+
+func (m ContainmentMetric) Name() string  { return m.name }
+func (m ContainmentMetric) Label() string { return m.label }
+
+func (m ContainmentMetric) Similarity(a, b []string) float64 {
+	similarity, _ := m.SimilarityDetails(a, b)
+	return similarity
+}
+
+// The shorter test's containment in the longer one, or the higher direction for tests of the same length
+func (m ContainmentMetric) SimilarityDetails(a, b []string) (float64, any) {
+	details := Containment{AInB: m.containment(a, b), BInA: m.containment(b, a)}
+	switch {
+	case len(a) < len(b):
+		return details.AInB, details
+	case len(b) < len(a):
+		return details.BInA, details
+	}
+	return math.Max(details.AInB, details.BInA), details
+}
+
+// Subsumer is a test that contains a redundant test
+type Subsumer struct {
+	Test  string          `json:"test"`
+	Ref   parsing.TestRef `json:"ref"`
+	Steps int             `json:"steps"`
+}
+
+// RedundantTest is a test whose steps are all contained in at least one other test
+type RedundantTest struct {
+	Test       string          `json:"test"`
+	Ref        parsing.TestRef `json:"ref"`
+	Steps      int             `json:"steps"`
+	SubsumedBy []Subsumer      `json:"subsumed_by"`
+}
+
+// Whether every step of a appears in b in the same order
+func isSubsequence(a, b []string) bool {
+	i := 0
+	for j := 0; i < len(a) && j < len(b); j++ {
+		if a[i] == b[j] {
+			i++
+		}
+	}
+	return i == len(a)
+}
+
+// Whether b uses every distinct step of a
+func isSubset(a, b []string) bool {
+	setB := stepCounts(b)
+	for _, step := range a {
+		if setB[step] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FindRedundantTests lists the tests entirely contained in another test, longest first.
+// Of two tests that contain each other, such as exact duplicates, only the later one is reported.
+// Each test is only checked against the tests sharing its rarest step, so the suite is never compared pairwise.
+func FindRedundantTests(tests []parsing.Test, corpus [][]string, mode string) []RedundantTest {
+	contains := isSubsequence
+	if mode == ContainmentSet {
+		contains = isSubset
+	}
+
+	users := make(map[string][]int) // Tests using each step, in order
+	for t, steps := range corpus {
+		for step := range stepCounts(steps) {
+			users[step] = append(users[step], t)
+		}
+	}
+
+	redundant := []RedundantTest{}
+	for a, steps := range corpus {
+		if len(steps) == 0 {
+			continue // An empty test has nothing to contain
+		}
+		rarest := steps[0]
+		for _, step := range steps {
+			if len(users[step]) < len(users[rarest]) {
+				rarest = step
+			}
+		}
+
+		var subsumers []Subsumer
+		for _, b := range users[rarest] {
+			if b == a || !contains(steps, corpus[b]) {
+				continue
+			}
+			if b > a && contains(corpus[b], steps) {
+				continue // Equivalent tests: the later one is reported instead
+			}
+			subsumers = append(subsumers, Subsumer{Test: tests[b].Name, Ref: tests[b].Ref, Steps: len(corpus[b])})
+		}
+		if subsumers != nil {
+			redundant = append(redundant, RedundantTest{Test: tests[a].Name, Ref: tests[a].Ref, Steps: len(steps), SubsumedBy: subsumers})
+		}
+	}
+
+	sort.SliceStable(redundant, func(i, j int) bool {
+		return redundant[i].Steps > redundant[j].Steps
+	})
+	return redundant
+}
+
+// Endpoint to list the tests whose steps are all contained in another test, the safest tests to delete
+func GetRedundantTests(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("containment")
+	if mode == "" {
+		mode = ContainmentSubsequence
+	}
+	if mode != ContainmentSubsequence && mode != ContainmentSet {
+		http.Error(w, fmt.Sprintf("Unknown containment %q (expected %s or %s)", mode, ContainmentSubsequence, ContainmentSet), http.StatusBadRequest)
+		return
+	}
+	tests, diagnostics, ok := loadTests(w, r)
+	if !ok {
+		return
+	}
+
+	response := struct {
+		Containment string               `json:"containment"`
+		Tests       int                  `json:"tests"`
+		Redundant   []RedundantTest      `json:"redundant"`
+		Diagnostics []parsing.Diagnostic `json:"diagnostics"`
+	}{
+		Containment: mode,
+		Tests:       len(tests),
+		Redundant:   FindRedundantTests(tests, normalizedSteps(tests), mode),
+		Diagnostics: diagnostics,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
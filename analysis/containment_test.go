@@ -0,0 +1,149 @@
+package analysis
+
+import (
+	"encoding/json"
+	"go-similarity-reports/parsing"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestContainmentMetrics(t *testing.T) {
+	short := checkoutBlock[1:4]
+	long := append(append([]string{"I am on the home page", "I search for shoes"}, checkoutBlock...), "I log out", "I close the tab", "I clear my cookies", "I go home")
+	reordered := []string{checkoutBlock[3], checkoutBlock[2], checkoutBlock[1]}
+
+	tests := []struct {
+		name     string
+		metric   func(a, b []string) float64
+		a, b     []string
+		expected float64
+	}{
+		{"subsequence", SubsequenceContainment, short, long, 1},
+		{"subsequence", SubsequenceContainment, long, short, 0.25},
+		{"subsequence", SubsequenceContainment, reordered, long, 1.0 / 3},
+		{"subsequence", SubsequenceContainment, nil, long, 0},
+		{"set", SetContainment, reordered, long, 1},
+		{"set", SetContainment, []string{"A", "A", "B"}, []string{"A", "C"}, 0.5},
+		{"set", SetContainment, nil, long, 0},
+		{"overlap", OverlapCoefficient, reordered, long, 1},
+		{"overlap", OverlapCoefficient, []string{"A", "B"}, []string{"B", "C", "D"}, 0.5},
+		{"overlap", OverlapCoefficient, nil, long, 0},
+	}
+	for _, test := range tests {
+		if result := test.metric(test.a, test.b); !closeTo(result, test.expected) {
+			t.Errorf("%s: expected %v for %v in %v, got %v", test.name, test.expected, test.a, test.b, result)
+		}
+	}
+
+	// The symmetric LCS barely sees the buried test, the containment metric scores it fully in either order
+	if lcs := LCSSimilarity(short, long); lcs > 0.3 {
+		t.Errorf("Expected LCS to score at most 0.3, got %v", lcs)
+	}
+	metric := NewContainmentMetric("subsequence_containment", "Subsequence Containment", SubsequenceContainment)
+	for _, pair := range [][2][]string{{short, long}, {long, short}} {
+		similarity, details := metric.SimilarityDetails(pair[0], pair[1])
+		if similarity != 1 {
+			t.Errorf("Expected containment 1, got %v (%+v)", similarity, details)
+		}
+	}
+	if _, details := metric.SimilarityDetails(short, long); details != (Containment{AInB: 1, BInA: 0.25}) {
+		t.Errorf("Expected both directions, got %+v", details)
+	}
+}
+
+func TestFindRedundantTests(t *testing.T) {
+	corpus := [][]string{
+		append([]string{"I am on the home page"}, checkoutBlock...),
+		checkoutBlock[1:4],
+		// Same steps as the previous test but out of order
+		{checkoutBlock[3], checkoutBlock[1], checkoutBlock[2]},
+		// An exact duplicate of the first test
+		append([]string{"I am on the home page"}, checkoutBlock...),
+		{"I search for shoes", "I open the basket"},
+		nil,
+	}
+	tests := make([]parsing.Test, len(corpus))
+	for i := range corpus {
+		tests[i] = parsing.Test{Name: string(rune('A' + i))}
+	}
+
+	subsumed := func(redundant []RedundantTest) map[string][]string {
+		result := make(map[string][]string)
+		for _, test := range redundant {
+			for _, by := range test.SubsumedBy {
+				result[test.Test] = append(result[test.Test], by.Test)
+			}
+		}
+		return result
+	}
+
+	modes := []struct {
+		mode     string
+		expected map[string][]string
+	}{
+		// Only the later of two equivalent tests is reported; out of order steps are not a subsequence
+		{ContainmentSubsequence, map[string][]string{"D": {"A"}, "B": {"A", "D"}}},
+		{ContainmentSet, map[string][]string{"D": {"A"}, "B": {"A", "D"}, "C": {"A", "B", "D"}}},
+	}
+	for _, test := range modes {
+		redundant := FindRedundantTests(tests, corpus, test.mode)
+		result := subsumed(redundant)
+		if len(result) != len(test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.mode, test.expected, result)
+		}
+		for name, by := range test.expected {
+			if len(result[name]) != len(by) {
+				t.Fatalf("%s: expected %v, got %v", test.mode, test.expected, result)
+			}
+			for k := range by {
+				if result[name][k] != by[k] {
+					t.Errorf("%s: expected %v, got %v", test.mode, test.expected, result)
+				}
+			}
+		}
+		// Longest first
+		if redundant[0].Test != "D" {
+			t.Errorf("%s: expected the duplicate first, got %s", test.mode, redundant[0].Test)
+		}
+	}
+}
+
+func TestGetRedundantTests(t *testing.T) {
+	shortFeature := `Feature: Short
+  Scenario: Just the login page
+    Given I am on the login page
+    When I search for "shoes"
+`
+	dir := writeFeatureDir(t, map[string]string{"search.feature": searchFeature, "short.feature": shortFeature})
+
+	req := httptest.NewRequest("GET", "/api/similarity-reports/redundant?"+url.Values{"directory": {dir}, "granularity": {"scenario"}}.Encode(), nil)
+	rr := httptest.NewRecorder()
+	GetRedundantTests(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Containment string          `json:"containment"`
+		Tests       int             `json:"tests"`
+		Redundant   []RedundantTest `json:"redundant"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if res.Containment != ContainmentSubsequence || res.Tests != 2 {
+		t.Errorf("Expected subsequence containment over 2 tests, got %s over %d", res.Containment, res.Tests)
+	}
+	if len(res.Redundant) != 1 || res.Redundant[0].Steps != 2 || len(res.Redundant[0].SubsumedBy) != 1 || res.Redundant[0].SubsumedBy[0].Steps != 3 {
+		t.Errorf("Expected the short scenario subsumed by the search scenario, got %+v", res.Redundant)
+	}
+
+	req = httptest.NewRequest("GET", "/api/similarity-reports/redundant?containment=fuzzy&directory="+dir, nil)
+	rr = httptest.NewRecorder()
+	GetRedundantTests(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got %d", rr.Code)
+	}
+}
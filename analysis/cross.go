@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"fmt"
+	"go-similarity-reports/parsing"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// DefaultMatchThreshold is the best-match similarity at which a suite B test counts as covered by suite A
+const DefaultMatchThreshold = 0.8
+
+// CrossSuiteOptions compare the tests of one directory against another instead of a directory against itself
+type CrossSuiteOptions struct {
+	DirectoryA     string
+	DirectoryB     string
+	MatchThreshold float64
+}
+
+// BestMatch is the suite A test closest to a suite B test; TestA is empty when no A test was compared with it
+type BestMatch struct {
+	TestB      string           `json:"test_b"`
+	RefB       parsing.TestRef  `json:"ref_b"`
+	TestA      string           `json:"test_a,omitempty"`
+	RefA       *parsing.TestRef `json:"ref_a,omitempty"`
+	Similarity float64          `json:"similarity"`
+	Covered    bool             `json:"covered"` // Whether the match reaches the match threshold
+}
+
+// CoverageSummary says how much of suite B already exists in suite A
+type CoverageSummary struct {
+	MatchThreshold     float64 `json:"match_threshold"`
+	TestsA             int     `json:"tests_a"`
+	TestsB             int     `json:"tests_b"`
+	Covered            int     `json:"covered"`
+	Uncovered          int     `json:"uncovered"`
+	Coverage           float64 `json:"coverage"` // Fraction of suite B that is covered
+	MeanBestSimilarity float64 `json:"mean_best_similarity"`
+}
+
+// Read directory_a, directory_b and match_threshold from the query; the options are nil unless both directories are given
+func crossSuiteFromQuery(query url.Values) (*CrossSuiteOptions, error) {
+	dirA, dirB := query.Get("directory_a"), query.Get("directory_b")
+	if dirA == "" && dirB == "" {
+		return nil, nil
+	}
+	if dirA == "" || dirB == "" {
+		return nil, fmt.Errorf("directory_a and directory_b must be given together")
+	}
+
+	opts := &CrossSuiteOptions{DirectoryA: dirA, DirectoryB: dirB, MatchThreshold: DefaultMatchThreshold}
+	if value := query.Get("match_threshold"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold < 0 || threshold > 1 {
+			return nil, fmt.Errorf("invalid match_threshold %q (expected a number between 0 and 1)", value)
+		}
+		opts.MatchThreshold = threshold
+	}
+	return opts, nil
+}
+
+// Mark the tests of each suite with its letter, in the ref and as a prefix of the name.
+// Files are relative to their own directory, so both suites may have a login.feature.
+func labelSuites(suites [][]parsing.Test) {
+	for s, tests := range suites {
+		label := string(rune('a' + s))
+		for i := range tests {
+			tests[i].Ref.Suite = label
+			tests[i].Name = label + ":" + tests[i].Name
+		}
+	}
+}
+
+// Load the tests of a request: both suites, suite A first, in cross-suite mode, or the single directory.
+// split is where suite B starts. Errors are written to w, in which case ok is false.
+func loadComparedTests(w http.ResponseWriter, r *http.Request, crossOpts *CrossSuiteOptions) (tests []parsing.Test, split int, diagnostics []parsing.Diagnostic, ok bool) {
+	if crossOpts == nil {
+		tests, diagnostics, ok = loadTests(w, r)
+		return tests, 0, diagnostics, ok
+	}
+	suites, diagnostics, ok := loadSuites(w, r, crossOpts.DirectoryA, crossOpts.DirectoryB)
+	if !ok {
+		return nil, 0, nil, false
+	}
+	labelSuites(suites)
+	return append(suites[0], suites[1]...), len(suites[0]), diagnostics, true
+}
+
+// bestMatches keeps the best suite A match of every suite B test for one metric.
+// Tests are indexed as in the combined list, suite A first, with suite B starting at split.
+type bestMatches struct {
+	tests []parsing.Test
+	split int
+	best  []int // Index of the best A test for each B test, -1 until one is compared
+	score []float64
+}
+
+func newBestMatches(tests []parsing.Test, split int) *bestMatches {
+	m := &bestMatches{tests: tests, split: split, best: make([]int, len(tests)-split), score: make([]float64, len(tests)-split)}
+	for k := range m.best {
+		m.best[k] = -1
+	}
+	return m
+}
+
+// Add a comparison of A test i with B test j; among equal scores the first A test is kept
+func (m *bestMatches) Add(i, j int, similarity float64) {
+	k := j - m.split
+	if m.best[k] == -1 || similarity > m.score[k] {
+		m.best[k], m.score[k] = i, similarity
+	}
+}
+
+// Results lists the best match of every B test in suite order, with the coverage of suite B
+func (m *bestMatches) Results(threshold float64) ([]BestMatch, *CoverageSummary) {
+	matches := make([]BestMatch, len(m.best))
+	summary := &CoverageSummary{MatchThreshold: threshold, TestsA: m.split, TestsB: len(m.best)}
+	total := 0.0
+	for k, i := range m.best {
+		b := m.tests[m.split+k]
+		match := BestMatch{TestB: b.Name, RefB: b.Ref}
+		if i != -1 {
+			ref := m.tests[i].Ref
+			match.TestA, match.RefA, match.Similarity = m.tests[i].Name, &ref, m.score[k]
+			match.Covered = match.Similarity >= threshold
+		}
+		if match.Covered {
+			summary.Covered++
+		}
+		total += match.Similarity
+		matches[k] = match
+	}
+	summary.Uncovered = summary.TestsB - summary.Covered
+	if summary.TestsB > 0 {
+		summary.Coverage = float64(summary.Covered) / float64(summary.TestsB)
+		summary.MeanBestSimilarity = total / float64(summary.TestsB)
+	}
+	return matches, summary
+}
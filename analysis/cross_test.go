@@ -0,0 +1,175 @@
+package analysis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const teamBFeature = `Feature: Team B
+  Scenario: Admin signs in
+    Given I am on the login page
+    When I log in as "admin"
+    Then I see the dashboard
+
+  Scenario: Checkout
+    Given I open the basket
+    When I pay by card
+    Then I see the confirmation
+`
+
+func TestCrossCandidatePairs(t *testing.T) {
+	corpus := testSteps(generateTests(12))
+
+	var pairs [][2]int
+	all, summary := crossCandidatePairs(corpus, 5, CandidateOptions{Method: "all"})
+	for i, j := range all {
+		pairs = append(pairs, [2]int{i, j})
+	}
+	if summary != nil || len(pairs) != 5*7 || pairs[0] != [2]int{0, 5} || pairs[len(pairs)-1] != [2]int{4, 11} {
+		t.Errorf("Expected the 35 pairs across the split, got %v", pairs)
+	}
+
+	lsh, summary := crossCandidatePairs(corpus, 5, CandidateOptions{Method: "lsh", Threshold: 0.5, Bands: 32, Rows: 4})
+	count := 0
+	for i, j := range lsh {
+		if i >= 5 || j < 5 {
+			t.Errorf("Expected only pairs across the split, got (%d, %d)", i, j)
+		}
+		count++
+	}
+	if summary == nil || summary.TotalPairs != 35 || summary.CandidatePairs != count {
+		t.Errorf("Unexpected summary for %d candidates: %+v", count, summary)
+	}
+}
+
+func TestGetSimilarityReportsCrossSuite(t *testing.T) {
+	dirA := writeFeatureDir(t, map[string]string{"login.feature": loginFeature, "search.feature": searchFeature})
+	dirB := writeFeatureDir(t, map[string]string{"team_b.feature": teamBFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory_a": {dirA}, "directory_b": {dirB}, "granularity": {"scenario"}, "metrics": {"jaccard"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports map[string]SimilarityReport `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	report := res.Reports["jaccard"]
+
+	// Only the 3 x 2 pairs across the suites are compared, always with suite A on the A side
+	if len(report.Comparisons) != 6 {
+		t.Fatalf("Expected 6 comparisons, got %d", len(report.Comparisons))
+	}
+	for _, comparison := range report.Comparisons {
+		if comparison.RefA.File == "team_b.feature" || comparison.RefB.File != "team_b.feature" {
+			t.Errorf("Expected suite A against suite B, got %s against %s", comparison.TestA, comparison.TestB)
+		}
+	}
+
+	// The admin login already exists in suite A, checkout does not
+	if len(report.BestMatches) != 2 {
+		t.Fatalf("Expected 2 best matches, got %+v", report.BestMatches)
+	}
+	admin, checkout := report.BestMatches[0], report.BestMatches[1]
+	if admin.RefB.Scenario != "Admin signs in" || admin.RefA == nil || admin.RefA.Scenario != "Admin logs in" || admin.Similarity != 1 || !admin.Covered {
+		t.Errorf("Unexpected best match: %+v", admin)
+	}
+	if checkout.RefB.Scenario != "Checkout" || checkout.Similarity != 0 || checkout.Covered {
+		t.Errorf("Unexpected best match: %+v", checkout)
+	}
+	expected := CoverageSummary{MatchThreshold: DefaultMatchThreshold, TestsA: 3, TestsB: 2, Covered: 1, Uncovered: 1, Coverage: 0.5, MeanBestSimilarity: 0.5}
+	if report.Coverage == nil || *report.Coverage != expected {
+		t.Errorf("Expected coverage %+v, got %+v", expected, report.Coverage)
+	}
+
+	// A lower threshold counts partial matches as covered
+	rr = getSimilarityReports(t, url.Values{"directory_a": {dirA}, "directory_b": {dirB}, "metrics": {"jaccard"}, "match_threshold": {"0"}})
+	res.Reports = nil
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if coverage := res.Reports["jaccard"].Coverage; coverage == nil || coverage.Covered != 1 || coverage.TestsA != 2 {
+		t.Errorf("Expected the single suite B feature covered by one of 2 features, got %+v", coverage)
+	}
+
+	// A plain report has no cross-suite fields
+	rr = getSimilarityReports(t, url.Values{"directory": {dirA}, "metrics": {"jaccard"}})
+	res.Reports = nil
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if report := res.Reports["jaccard"]; report.BestMatches != nil || report.Coverage != nil {
+		t.Errorf("Expected no best matches or coverage, got %+v", report)
+	}
+}
+
+func TestGetSimilarityReportsCrossSuiteSameFile(t *testing.T) {
+	// Both suites have the same login.feature, so only the suite tells their tests apart
+	dirA := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+	dirB := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+	query := url.Values{"directory_a": {dirA}, "directory_b": {dirB}, "granularity": {"scenario"}, "metrics": {"jaccard"}}
+
+	rr := getSimilarityReports(t, query)
+	var res struct {
+		Reports map[string]SimilarityReport `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	matches := res.Reports["jaccard"].BestMatches
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 best matches, got %+v", matches)
+	}
+	admin := matches[0]
+	if admin.TestB != "b:login.feature:2 Admin logs in" || admin.RefB.Suite != "b" || admin.TestA != "a:login.feature:2 Admin logs in" || admin.RefA.Suite != "a" || admin.Similarity != 1 {
+		t.Errorf("Unexpected best match: %+v", admin)
+	}
+
+	// The explain endpoint finds each side of the pair in its own suite
+	query.Set("a", admin.TestA)
+	query.Set("b", admin.TestB)
+	req := httptest.NewRequest("GET", "/api/similarity-reports/explain?"+query.Encode(), nil)
+	rr = httptest.NewRecorder()
+	GetSimilarityExplanation(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var explanation struct {
+		TestA ExplainedTest `json:"test_a"`
+		TestB ExplainedTest `json:"test_b"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&explanation); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if explanation.TestA.Ref.Suite != "a" || explanation.TestB.Ref.Suite != "b" {
+		t.Errorf("Expected one test from each suite, got %+v and %+v", explanation.TestA.Ref, explanation.TestB.Ref)
+	}
+}
+
+func TestGetSimilarityReportsCrossSuiteErrors(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	tests := []struct {
+		query  url.Values
+		accept string
+	}{
+		{url.Values{"directory_a": {dir}}, ""},
+		{url.Values{"directory_a": {dir}, "directory_b": {dir}, "match_threshold": {"2"}}, ""},
+		{url.Values{"directory_a": {dir}, "directory_b": {dir}}, NDJSONContentType},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/api/similarity-reports?"+test.query.Encode(), nil)
+		req.Header.Set("Accept", test.accept)
+		rr := httptest.NewRecorder()
+		GetSimilarityReports(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code 400 for %v, got %d", test.query, rr.Code)
+		}
+	}
+}
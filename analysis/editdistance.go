@@ -0,0 +1,183 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// EditCosts are the weights of the edit operations used by EditDistance
+type EditCosts struct {
+	Insert     float64 `json:"insert"`
+	Delete     float64 `json:"delete"`
+	Substitute float64 `json:"substitute"` // Cost of replacing a step with a completely unrelated one
+	Transpose  float64 `json:"transpose"`  // Cost of swapping two adjacent steps
+}
+
+// DefaultEditCosts weighs every operation equally
+var DefaultEditCosts = EditCosts{Insert: 1, Delete: 1, Substitute: 1, Transpose: 1}
+
+// Edit operations reported in an edit script
+const (
+	EditMatch      = "match"
+	EditSubstitute = "substitute"
+	EditInsert     = "insert"
+	EditDelete     = "delete"
+	EditTranspose  = "transpose"
+)
+
+// EditOp is one step of an edit script turning test A into test B.
+// IndexA and IndexB are -1 when the operation has no step on that side;
+// a transposition points at the first step of the swapped pair on each side.
+type EditOp struct {
+	Op     string  `json:"op"`
+	IndexA int     `json:"index_a"`
+	IndexB int     `json:"index_b"`
+	A      string  `json:"a,omitempty"`
+	B      string  `json:"b,omitempty"`
+	Cost   float64 `json:"cost"`
+}
+
+// EditScript is the cheapest alignment of two step sequences
+type EditScript struct {
+	Distance   float64  `json:"distance"`
+	Operations []EditOp `json:"operations"`
+}
+
+// EditDistance computes a weighted Damerau-Levenshtein (optimal string alignment) distance between two step sequences.
+// Substituting a step costs costs.Substitute scaled by how different the two steps are,
+// so rewording a step is cheaper than replacing it with an unrelated one.
+func EditDistance(a, b []string, costs EditCosts) EditScript {
+	m, n := len(a), len(b)
+	dp := make([][]float64, m+1)
+	for i := range dp {
+		dp[i] = make([]float64, n+1)
+	}
+	for i := 1; i <= m; i++ {
+		dp[i][0] = dp[i-1][0] + costs.Delete
+	}
+	for j := 1; j <= n; j++ {
+		dp[0][j] = dp[0][j-1] + costs.Insert
+	}
+
+	for i := 1; i <= m; i++ {
+		for j := 1; j <= n; j++ {
+			best := dp[i-1][j-1] + substituteCost(a[i-1], b[j-1], costs)
+			best = math.Min(best, dp[i-1][j]+costs.Delete)
+			best = math.Min(best, dp[i][j-1]+costs.Insert)
+			if transposed(a, b, i, j) {
+				best = math.Min(best, dp[i-2][j-2]+costs.Transpose)
+			}
+			dp[i][j] = best
+		}
+	}
+
+	// Walk back from the end to recover the operations that produced the distance
+	var operations []EditOp
+	i, j := m, n
+	for i > 0 || j > 0 {
+		switch {
+		case i > 0 && j > 0 && sameCost(dp[i][j], dp[i-1][j-1]+substituteCost(a[i-1], b[j-1], costs)):
+			op := EditSubstitute
+			if a[i-1] == b[j-1] {
+				op = EditMatch
+			}
+			operations = append(operations, EditOp{Op: op, IndexA: i - 1, IndexB: j - 1, A: a[i-1], B: b[j-1], Cost: dp[i][j] - dp[i-1][j-1]})
+			i, j = i-1, j-1
+		case transposed(a, b, i, j) && sameCost(dp[i][j], dp[i-2][j-2]+costs.Transpose):
+			operations = append(operations, EditOp{Op: EditTranspose, IndexA: i - 2, IndexB: j - 2, A: a[i-2], B: b[j-2], Cost: costs.Transpose})
+			i, j = i-2, j-2
+		case i > 0 && sameCost(dp[i][j], dp[i-1][j]+costs.Delete):
+			operations = append(operations, EditOp{Op: EditDelete, IndexA: i - 1, IndexB: -1, A: a[i-1], Cost: costs.Delete})
+			i--
+		default:
+			operations = append(operations, EditOp{Op: EditInsert, IndexA: -1, IndexB: j - 1, B: b[j-1], Cost: costs.Insert})
+			j--
+		}
+	}
+	for left, right := 0, len(operations)-1; left < right; left, right = left+1, right-1 {
+		operations[left], operations[right] = operations[right], operations[left]
+	}
+
+	return EditScript{Distance: dp[m][n], Operations: operations}
+}
+
+// Whether the steps ending at a[i-1] and b[j-1] are an adjacent pair swapped between the tests
+func transposed(a, b []string, i, j int) bool {
+	return i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && a[i-1] != a[i-2]
+}
+
+// Substitution is free for identical steps, costs the full weight for steps with no words in common,
+// and is scaled by the steps' word overlap in between
+func substituteCost(x, y string, costs EditCosts) float64 {
+	if x == y {
+		return 0
+	}
+	return costs.Substitute * (1 - wordOverlap(x, y))
+}
+
+// Jaccard index of the words of two steps
+func wordOverlap(x, y string) float64 {
+	return JaccardIndex(strings.Fields(strings.ToLower(x)), strings.Fields(strings.ToLower(y)))
+}
+
+func sameCost(x, y float64) bool {
+	return math.Abs(x-y) < 1e-9
+}
+
+// EditDistanceSimilarity scales the edit distance against deleting every step of A and inserting every step of B,
+// which is the most any edit script needs to cost
+func EditDistanceSimilarity(a, b []string, costs EditCosts) float64 {
+	similarity, _ := editDistanceScore(a, b, costs)
+	return similarity
+}
+
+func editDistanceScore(a, b []string, costs EditCosts) (float64, EditScript) {
+	script := EditDistance(a, b, costs)
+	worst := float64(len(a))*costs.Delete + float64(len(b))*costs.Insert
+	if worst == 0 {
+		return 0.0, script // Two empty tests have nothing to compare
+	}
+	return math.Max(0, 1-script.Distance/worst), script
+}
+
+// EditDistanceMetric is the weighted edit distance as a SimilarityMetric.
+// Its comparisons carry the edit script as details, and its costs can be set per request.
+type EditDistanceMetric struct {
+	Costs EditCosts
+}
+
+func (m EditDistanceMetric) Name() string  { return "edit_distance" }
+func (m EditDistanceMetric) Label() string { return "Edit Distance" }
+
+func (m EditDistanceMetric) Similarity(a, b []string) float64 {
+	return EditDistanceSimilarity(a, b, m.Costs)
+}
+
+func (m EditDistanceMetric) SimilarityDetails(a, b []string) (float64, any) {
+	return editDistanceScore(a, b, m.Costs)
+}
+
+// Configure reads edit_insert, edit_delete, edit_substitute and edit_transpose from the query
+func (m EditDistanceMetric) Configure(query url.Values) (SimilarityMetric, error) {
+	costs := m.Costs
+	for key, cost := range map[string]*float64{
+		"edit_insert":     &costs.Insert,
+		"edit_delete":     &costs.Delete,
+		"edit_substitute": &costs.Substitute,
+		"edit_transpose":  &costs.Transpose,
+	} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+			return nil, fmt.Errorf("invalid %s %q (expected a non-negative number)", key, value)
+		}
+		*cost = parsed
+	}
+	return EditDistanceMetric{Costs: costs}, nil
+}
@@ -0,0 +1,127 @@
+package analysis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     []string
+		costs    EditCosts
+		expected float64
+		ops      []string
+	}{
+		{[]string{"A", "B", "C"}, []string{"A", "B", "C"}, DefaultEditCosts, 0, []string{EditMatch, EditMatch, EditMatch}},
+		{[]string{"A", "B", "C"}, []string{"A", "C", "B"}, DefaultEditCosts, 1, []string{EditMatch, EditTranspose}},
+		{[]string{"A", "B", "C"}, []string{"A", "C"}, DefaultEditCosts, 1, []string{EditMatch, EditDelete, EditMatch}},
+		{[]string{"A"}, []string{"A", "B"}, EditCosts{Insert: 3, Delete: 1, Substitute: 1, Transpose: 1}, 3, []string{EditMatch, EditInsert}},
+		// Swapping costs more than deleting and re-inserting, so the cheaper script is used
+		{[]string{"A", "B"}, []string{"B", "A"}, EditCosts{Insert: 1, Delete: 1, Substitute: 5, Transpose: 5}, 2, []string{EditInsert, EditMatch, EditDelete}},
+		{nil, []string{"A", "B"}, DefaultEditCosts, 2, []string{EditInsert, EditInsert}},
+	}
+
+	for _, test := range tests {
+		script := EditDistance(test.a, test.b, test.costs)
+		if script.Distance != test.expected {
+			t.Errorf("Expected distance %v for %v -> %v, got %v", test.expected, test.a, test.b, script.Distance)
+		}
+		var ops []string
+		for _, op := range script.Operations {
+			ops = append(ops, op.Op)
+		}
+		if len(ops) != len(test.ops) {
+			t.Errorf("Expected operations %v, got %v", test.ops, ops)
+			continue
+		}
+		for i := range ops {
+			if ops[i] != test.ops[i] {
+				t.Errorf("Expected operations %v, got %v", test.ops, ops)
+				break
+			}
+		}
+	}
+}
+
+func TestEditDistanceSubstitution(t *testing.T) {
+	a := []string{"I log in as admin"}
+	similar := EditDistance(a, []string{"I log in as guest"}, DefaultEditCosts)
+	unrelated := EditDistance(a, []string{"the basket is empty"}, DefaultEditCosts)
+
+	// Rewording one word of a step costs less than replacing it
+	if similar.Distance >= unrelated.Distance {
+		t.Errorf("Expected similar steps to be cheaper to substitute, got %v and %v", similar.Distance, unrelated.Distance)
+	}
+	// The cost is scaled by the word overlap alone: 4 of 6 distinct words are shared
+	if !closeTo(similar.Distance, 1.0/3) {
+		t.Errorf("Expected the substitution to cost 1/3, got %v", similar.Distance)
+	}
+	if unrelated.Distance != 1 {
+		t.Errorf("Expected unrelated substitution to cost 1, got %v", unrelated.Distance)
+	}
+	if op := similar.Operations[0]; op.Op != EditSubstitute || op.A != "I log in as admin" || op.B != "I log in as guest" {
+		t.Errorf("Unexpected operation: %+v", op)
+	}
+}
+
+func TestEditDistanceSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     []string
+		expected float64
+	}{
+		{[]string{"A", "B"}, []string{"A", "B"}, 1},
+		{[]string{"A", "B"}, []string{"C", "D"}, 0.5},
+		{[]string{"A", "B", "C"}, []string{"A", "B", "C", "D", "E"}, 0.75},
+		{nil, nil, 0},
+	}
+
+	for _, test := range tests {
+		if result := EditDistanceSimilarity(test.a, test.b, DefaultEditCosts); result != test.expected {
+			t.Errorf("Expected %v for %v and %v, got %v", test.expected, test.a, test.b, result)
+		}
+	}
+}
+
+func TestGetSimilarityReportsEditDistance(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"scenario"}, "metrics": {"edit_distance"}, "edit_substitute": {"2"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports map[string]struct {
+			Comparisons []struct {
+				Similarity float64    `json:"similarity"`
+				Details    EditScript `json:"details"`
+			} `json:"comparisons"`
+		} `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// The scenarios differ in one word of their middle step
+	entry := res.Reports["edit_distance"].Comparisons[0]
+	if len(entry.Details.Operations) != 3 || entry.Details.Operations[1].Op != EditSubstitute {
+		t.Fatalf("Unexpected edit script: %+v", entry.Details)
+	}
+	if cost := entry.Details.Operations[1].Cost; cost <= 0 || cost >= 2 {
+		t.Errorf("Expected a partial substitution cost, got %v", cost)
+	}
+	if entry.Similarity <= 0.5 || entry.Similarity >= 1 {
+		t.Errorf("Expected similarity between 0.5 and 1, got %v", entry.Similarity)
+	}
+}
+
+func TestGetSimilarityReportsInvalidEditCost(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "metrics": {"edit_distance"}, "edit_insert": {"-1"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"go-similarity-reports/parsing"
+	"iter"
+	"net/url"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// Pairs handed to a worker at a time, large enough to keep channel overhead small
+const pairBatchSize = 256
+
+type pairBatch struct {
+	seq   int
+	pairs [][2]int
+}
+
+type batchResult struct {
+	seq     int
+	pairs   [][2]int
+	entries [][]ComparisonEntry // One slice per pair, holding one entry per metric
+}
+
+// Most workers per CPU a request can ask for; comparisons are CPU bound, so more only cost goroutines and channel space
+const maxWorkersPerCPU = 4
+
+// Read workers= from the query, defaulting to one worker per CPU and capped at maxWorkersPerCPU per CPU
+func workersFromQuery(query url.Values) (int, error) {
+	value := query.Get("workers")
+	if value == "" {
+		return runtime.GOMAXPROCS(0), nil
+	}
+	workers, err := strconv.Atoi(value)
+	if err != nil || workers < 1 {
+		return 0, fmt.Errorf("invalid workers %q (expected a positive integer)", value)
+	}
+	return min(workers, runtime.GOMAXPROCS(0)*maxWorkersPerCPU), nil
+}
+
+// comparePairs runs every metric over the pairs on a pool of workers.
+// emit is called once per pair (i, j), on the calling goroutine and in the order of pairs, with one entry per metric.
+// It stops early when ctx is done or emit returns an error, and returns that error.
+func comparePairs(ctx context.Context, tests []parsing.Test, pairs iter.Seq2[int, int], metrics []SimilarityMetric, workers int, emit func(i, j int, entries []ComparisonEntry) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Producer: cut the pairs into numbered batches
+	jobs := make(chan pairBatch, workers)
+	go func() {
+		defer close(jobs)
+		batch := pairBatch{}
+		send := func() bool {
+			select {
+			case jobs <- batch:
+				batch = pairBatch{seq: batch.seq + 1}
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for i, j := range pairs {
+			batch.pairs = append(batch.pairs, [2]int{i, j})
+			if len(batch.pairs) == pairBatchSize && !send() {
+				return
+			}
+		}
+		if len(batch.pairs) > 0 {
+			send()
+		}
+	}()
+
+	// Workers: compare every pair of a batch with every metric
+	results := make(chan batchResult, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range jobs {
+				result := batchResult{seq: batch.seq, pairs: batch.pairs, entries: make([][]ComparisonEntry, 0, len(batch.pairs))}
+				for _, pair := range batch.pairs {
+					if ctx.Err() != nil {
+						return
+					}
+					entries := make([]ComparisonEntry, len(metrics))
+					for k, metric := range metrics {
+						entries[k] = compareTests(tests[pair[0]], tests[pair[1]], metric)
+					}
+					result.entries = append(result.entries, entries)
+				}
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Collector: hold batches that finish early until every batch before them was emitted
+	pending := make(map[int]batchResult)
+	next := 0
+	var emitErr error
+	for result := range results {
+		if emitErr != nil {
+			continue // Drain so the workers can exit
+		}
+		pending[result.seq] = result
+		for {
+			ready, found := pending[next]
+			if !found {
+				break
+			}
+			delete(pending, next)
+			next++
+			for p, entries := range ready.entries {
+				if emitErr = emit(ready.pairs[p][0], ready.pairs[p][1], entries); emitErr != nil {
+					cancel()
+					break
+				}
+			}
+			if emitErr != nil {
+				break
+			}
+		}
+	}
+
+	if emitErr != nil {
+		return emitErr
+	}
+	return ctx.Err()
+}
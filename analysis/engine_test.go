@@ -0,0 +1,110 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-similarity-reports/parsing"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"testing"
+)
+
+// Helper function to build tests with overlapping steps
+func generateTests(n int) []parsing.Test {
+	tests := make([]parsing.Test, n)
+	for i := range tests {
+		tests[i] = parsing.Test{
+			Name:  fmt.Sprintf("test %d", i),
+			Steps: []string{"I am logged in", fmt.Sprintf("I open page %d", i%7), fmt.Sprintf("I see item %d", i%5)},
+		}
+	}
+	return tests
+}
+
+func TestComparePairsOrder(t *testing.T) {
+	tests := generateTests(60) // 1770 pairs, several batches
+	metrics := []SimilarityMetric{NewMetric("lcs", "LCS", LCSSimilarity), NewMetric("jaccard", "Jaccard Index", JaccardIndex)}
+
+	// The sequential loop the engine has to reproduce
+	var expected []ComparisonEntry
+	for i := 0; i < len(tests); i++ {
+		for j := i + 1; j < len(tests); j++ {
+			expected = append(expected, compareTests(tests[i], tests[j], metrics[1]))
+		}
+	}
+
+	for _, workers := range []int{1, 3, 16} {
+		var result []ComparisonEntry
+		err := comparePairs(context.Background(), tests, allPairs(len(tests)), metrics, workers, func(i, j int, entries []ComparisonEntry) error {
+			if len(entries) != len(metrics) {
+				t.Fatalf("Expected %d entries per pair, got %d", len(metrics), len(entries))
+			}
+			result = append(result, entries[1])
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error with %d workers: %v", workers, err)
+		}
+		if len(result) != len(expected) {
+			t.Fatalf("Expected %d comparisons with %d workers, got %d", len(expected), workers, len(result))
+		}
+		for k := range expected {
+			if result[k].TestA != expected[k].TestA || result[k].TestB != expected[k].TestB || result[k].Similarity != expected[k].Similarity {
+				t.Fatalf("Comparison %d with %d workers: expected %+v, got %+v", k, workers, expected[k], result[k])
+			}
+		}
+	}
+}
+
+func TestComparePairsCancellation(t *testing.T) {
+	tests := generateTests(60)
+	metrics := []SimilarityMetric{NewMetric("lcs", "LCS", LCSSimilarity)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := comparePairs(ctx, tests, allPairs(len(tests)), metrics, 4, func(int, int, []ComparisonEntry) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// An emit error stops the run and is returned
+	stop := errors.New("stop")
+	emitted := 0
+	err = comparePairs(context.Background(), tests, allPairs(len(tests)), metrics, 4, func(int, int, []ComparisonEntry) error {
+		emitted++
+		if emitted == 10 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || emitted != 10 {
+		t.Errorf("Expected to stop after 10 comparisons, got %d and %v", emitted, err)
+	}
+}
+
+func TestGetSimilarityReportsWorkers(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature, "search.feature": searchFeature})
+
+	if rr := getSimilarityReports(t, url.Values{"directory": {dir}, "workers": {"0"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got %d", rr.Code)
+	}
+	if rr := getSimilarityReports(t, url.Values{"directory": {dir}, "workers": {"2"}}); rr.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got %d", rr.Code)
+	}
+	if workers, err := workersFromQuery(url.Values{"workers": {"10000000"}}); err != nil || workers != runtime.GOMAXPROCS(0)*maxWorkersPerCPU {
+		t.Errorf("Expected workers to be capped at %d, got %d (%v)", runtime.GOMAXPROCS(0)*maxWorkersPerCPU, workers, err)
+	}
+
+	// A request whose client has gone away stops computing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/api/similarity-reports?"+url.Values{"directory": {dir}}.Encode(), nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	GetSimilarityReports(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code 503, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,259 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-similarity-reports/parsing"
+	"math"
+	"net/http"
+)
+
+// LCSExplanation gives the terms of LCSSimilarity: Common / (LengthA + LengthB - Common)
+type LCSExplanation struct {
+	Common  int `json:"common"` // Length of the longest common subsequence
+	LengthA int `json:"length_a"`
+	LengthB int `json:"length_b"`
+	Union   int `json:"union"`
+}
+
+// SetOverlapExplanation gives the distinct step counts behind JaccardIndex and OverlapCoefficient
+type SetOverlapExplanation struct {
+	Intersection int `json:"intersection"`
+	Union        int `json:"union"`
+	SizeA        int `json:"size_a"`
+	SizeB        int `json:"size_b"`
+}
+
+// WeightedTerm is one step's entry in the vectors of a cosine or weighted metric
+type WeightedTerm struct {
+	Step    string  `json:"step"`
+	CountA  int     `json:"count_a"`
+	CountB  int     `json:"count_b"`
+	Weight  float64 `json:"weight"`
+	Product float64 `json:"product"` // Contribution to the dot product
+}
+
+// CosineExplanation gives the dot product terms of the shared steps and the vector magnitudes
+type CosineExplanation struct {
+	Terms      []WeightedTerm `json:"terms"`
+	DotProduct float64        `json:"dot_product"`
+	MagnitudeA float64        `json:"magnitude_a"`
+	MagnitudeB float64        `json:"magnitude_b"`
+}
+
+// ExplainLCS breaks LCSSimilarity down into the subsequence length and the test lengths
+func ExplainLCS(a, b []string) any {
+	common := LCS(a, b)
+	return LCSExplanation{Common: common, LengthA: len(a), LengthB: len(b), Union: len(a) + len(b) - common}
+}
+
+// ExplainSetOverlap counts the distinct steps of each test and those they share
+func ExplainSetOverlap(a, b []string) any {
+	setA, setB := stepCounts(a), stepCounts(b)
+	intersection := 0
+	for step := range setA {
+		if setB[step] > 0 {
+			intersection++
+		}
+	}
+	return SetOverlapExplanation{Intersection: intersection, Union: len(setA) + len(setB) - intersection, SizeA: len(setA), SizeB: len(setB)}
+}
+
+// ExplainCosine lists the dot product terms of CosineSimilarity
+func ExplainCosine(a, b []string) any {
+	return explainCosine(a, b, func(string) float64 { return 1 })
+}
+
+func explainCosine(a, b []string, weight StepWeight) CosineExplanation {
+	countA, countB := stepCounts(a), stepCounts(b)
+	explanation := CosineExplanation{Terms: []WeightedTerm{}}
+	magA, magB := 0.0, 0.0
+	for _, step := range sortedSteps(countA, countB) {
+		term := weightedTerm(step, countA, countB, weight)
+		x, y := float64(term.CountA)*term.Weight, float64(term.CountB)*term.Weight
+		magA += x * x
+		magB += y * y
+		if term.Product > 0 {
+			explanation.Terms = append(explanation.Terms, term)
+			explanation.DotProduct += term.Product
+		}
+	}
+	explanation.MagnitudeA, explanation.MagnitudeB = math.Sqrt(magA), math.Sqrt(magB)
+	return explanation
+}
+
+func weightedTerm(step string, countA, countB map[string]int, weight StepWeight) WeightedTerm {
+	w := weight(step)
+	return WeightedTerm{
+		Step:    step,
+		CountA:  countA[step],
+		CountB:  countB[step],
+		Weight:  w,
+		Product: float64(countA[step]) * w * float64(countB[step]) * w,
+	}
+}
+
+// Explain lists the IDF weighted count of every step in either test
+func (m WeightedMetric) Explain(a, b []string) any {
+	countA, countB := stepCounts(a), stepCounts(b)
+	terms := []WeightedTerm{}
+	for _, step := range sortedSteps(countA, countB) {
+		terms = append(terms, weightedTerm(step, countA, countB, m.IDF.IDF))
+	}
+	return terms
+}
+
+// Diff two tests along their longest common subsequence, as matches and steps only in one test
+func lcsDiff(a, b []string) []AlignedStep {
+	m, n := len(a), len(b)
+	dp := make([][]int, m+1)
+	for i := range dp {
+		dp[i] = make([]int, n+1)
+	}
+	for i := m - 1; i >= 0; i-- {
+		for j := n - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+
+	// Walk forwards so the diff reads in step order, removals before additions
+	diff := []AlignedStep{}
+	i, j := 0, 0
+	for i < m || j < n {
+		switch {
+		case i < m && j < n && a[i] == b[j]:
+			diff = append(diff, AlignedStep{Op: AlignMatch, IndexA: i, IndexB: j, A: a[i], B: b[j]})
+			i, j = i+1, j+1
+		case j == n || (i < m && dp[i+1][j] >= dp[i][j+1]):
+			diff = append(diff, AlignedStep{Op: AlignGapB, IndexA: i, IndexB: -1, A: a[i]})
+			i++
+		default:
+			diff = append(diff, AlignedStep{Op: AlignGapA, IndexA: -1, IndexB: j, B: b[j]})
+			j++
+		}
+	}
+	return diff
+}
+
+// Distinct steps of a, in order, split by whether b uses them
+func splitSteps(a, b []string) (shared, only []string) {
+	setB := stepCounts(b)
+	seen := make(map[string]bool)
+	shared, only = []string{}, []string{}
+	for _, step := range a {
+		if seen[step] {
+			continue
+		}
+		seen[step] = true
+		if setB[step] > 0 {
+			shared = append(shared, step)
+		} else {
+			only = append(only, step)
+		}
+	}
+	return shared, only
+}
+
+// ExplainedTest identifies one side of an explained pair
+type ExplainedTest struct {
+	Test  string          `json:"test"`
+	Ref   parsing.TestRef `json:"ref"`
+	Steps []string        `json:"steps"`
+}
+
+// MetricExplanation is one metric's score for the pair and how it was reached
+type MetricExplanation struct {
+	Metric      string  `json:"metric"`
+	Label       string  `json:"label"`
+	Similarity  float64 `json:"similarity"`
+	Explanation any     `json:"explanation,omitempty"`
+}
+
+// Find a test by the name used as test_a and test_b in the reports
+func findTest(tests []parsing.Test, name string) (parsing.Test, bool) {
+	for _, test := range tests {
+		if test.Name == name {
+			return test, true
+		}
+	}
+	return parsing.Test{}, false
+}
+
+// Endpoint to explain why two tests are similar: their step diff and each metric's breakdown
+func GetSimilarityExplanation(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	nameA, nameB := query.Get("a"), query.Get("b")
+	if nameA == "" || nameB == "" {
+		http.Error(w, "Both a and b are required (the test names from a similarity report)", http.StatusBadRequest)
+		return
+	}
+	metrics, err := metricsFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	crossOpts, err := crossSuiteFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tests, _, diagnostics, ok := loadComparedTests(w, r, crossOpts)
+	if !ok {
+		return
+	}
+
+	a, found := findTest(tests, nameA)
+	if !found {
+		http.Error(w, fmt.Sprintf("Test %q not found", nameA), http.StatusNotFound)
+		return
+	}
+	b, found := findTest(tests, nameB)
+	if !found {
+		http.Error(w, fmt.Sprintf("Test %q not found", nameB), http.StatusNotFound)
+		return
+	}
+
+	breakdown := []MetricExplanation{}
+	for _, metric := range fitMetrics(metrics, tests) {
+		explanation := MetricExplanation{Metric: metric.Name(), Label: metric.Label()}
+		steps, _, _ := representations(metric)
+		switch m := steps.(type) {
+		case Explainer:
+			explanation.Similarity, explanation.Explanation = m.Similarity(a.Steps, b.Steps), m.Explain(a.Steps, b.Steps)
+		case DetailedMetric:
+			explanation.Similarity, explanation.Explanation = m.SimilarityDetails(a.Steps, b.Steps)
+		default:
+			explanation.Similarity = m.Similarity(a.Steps, b.Steps)
+		}
+		breakdown = append(breakdown, explanation)
+	}
+
+	sharedSteps, onlyA := splitSteps(a.Steps, b.Steps)
+	_, onlyB := splitSteps(b.Steps, a.Steps)
+	response := struct {
+		TestA       ExplainedTest        `json:"test_a"`
+		TestB       ExplainedTest        `json:"test_b"`
+		Diff        []AlignedStep        `json:"diff"`
+		SharedSteps []string             `json:"shared_steps"`
+		OnlyA       []string             `json:"only_a"`
+		OnlyB       []string             `json:"only_b"`
+		Metrics     []MetricExplanation  `json:"metrics"`
+		Diagnostics []parsing.Diagnostic `json:"diagnostics"`
+	}{
+		TestA:       ExplainedTest{Test: a.Name, Ref: a.Ref, Steps: a.Steps},
+		TestB:       ExplainedTest{Test: b.Name, Ref: b.Ref, Steps: b.Steps},
+		Diff:        lcsDiff(a.Steps, b.Steps),
+		SharedSteps: sharedSteps,
+		OnlyA:       onlyA,
+		OnlyB:       onlyB,
+		Metrics:     breakdown,
+		Diagnostics: diagnostics,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
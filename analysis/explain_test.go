@@ -0,0 +1,145 @@
+package analysis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestLCSDiff(t *testing.T) {
+	a := []string{"A", "B", "C", "D"}
+	b := []string{"A", "X", "C", "D", "E"}
+
+	diff := lcsDiff(a, b)
+	expected := []AlignedStep{
+		{Op: AlignMatch, IndexA: 0, IndexB: 0, A: "A", B: "A"},
+		{Op: AlignGapB, IndexA: 1, IndexB: -1, A: "B"},
+		{Op: AlignGapA, IndexA: -1, IndexB: 1, B: "X"},
+		{Op: AlignMatch, IndexA: 2, IndexB: 2, A: "C", B: "C"},
+		{Op: AlignMatch, IndexA: 3, IndexB: 3, A: "D", B: "D"},
+		{Op: AlignGapA, IndexA: -1, IndexB: 4, B: "E"},
+	}
+	if len(diff) != len(expected) {
+		t.Fatalf("Expected diff %+v, got %+v", expected, diff)
+	}
+	for k := range expected {
+		if diff[k] != expected[k] {
+			t.Errorf("Expected step %d to be %+v, got %+v", k, expected[k], diff[k])
+		}
+	}
+
+	if empty := lcsDiff(nil, nil); len(empty) != 0 {
+		t.Errorf("Expected an empty diff, got %+v", empty)
+	}
+}
+
+func TestExplanations(t *testing.T) {
+	a := []string{"A", "A", "B", "C"}
+	b := []string{"A", "B", "D"}
+
+	if lcs := ExplainLCS(a, b).(LCSExplanation); lcs != (LCSExplanation{Common: 2, LengthA: 4, LengthB: 3, Union: 5}) {
+		t.Errorf("Unexpected LCS explanation: %+v", lcs)
+	}
+	if sets := ExplainSetOverlap(a, b).(SetOverlapExplanation); sets != (SetOverlapExplanation{Intersection: 2, Union: 4, SizeA: 3, SizeB: 3}) {
+		t.Errorf("Unexpected set explanation: %+v", sets)
+	}
+
+	// The terms add up to the score
+	cosine := ExplainCosine(a, b).(CosineExplanation)
+	if len(cosine.Terms) != 2 || cosine.Terms[0].Step != "A" || cosine.Terms[0].Product != 2 || cosine.DotProduct != 3 {
+		t.Errorf("Unexpected cosine explanation: %+v", cosine)
+	}
+	if score := cosine.DotProduct / (cosine.MagnitudeA * cosine.MagnitudeB); !closeTo(score, CosineSimilarity(a, b)) {
+		t.Errorf("Expected the terms to give %v, got %v", CosineSimilarity(a, b), score)
+	}
+
+	// Fitted weighted metrics report the IDF of every step
+	metric := NewWeightedMetric("tfidf_cosine", "TF-IDF Cosine Similarity", WeightedCosineSimilarity).Fit([][]string{a, b, {"A"}})
+	terms := metric.(Explainer).Explain(a, b).([]WeightedTerm)
+	if len(terms) != 4 || terms[0].Step != "A" || terms[0].Weight != 1 || terms[3].Step != "D" || terms[3].Product != 0 {
+		t.Errorf("Unexpected weighted terms: %+v", terms)
+	}
+}
+
+func TestGetSimilarityExplanation(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	// Explain the pair by the names the report gives it
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"scenario"}, "metrics": {"lcs"}})
+	var report struct {
+		Reports map[string]SimilarityReport `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	pair := report.Reports["lcs"].Comparisons[0]
+
+	query := url.Values{"directory": {dir}, "granularity": {"scenario"}, "a": {pair.TestA}, "b": {pair.TestB}, "metrics": {"lcs,jaccard,edit_distance,lsa"}}
+	req := httptest.NewRequest("GET", "/api/similarity-reports/explain?"+query.Encode(), nil)
+	rr = httptest.NewRecorder()
+	GetSimilarityExplanation(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		TestA       ExplainedTest `json:"test_a"`
+		Diff        []AlignedStep `json:"diff"`
+		SharedSteps []string      `json:"shared_steps"`
+		OnlyA       []string      `json:"only_a"`
+		OnlyB       []string      `json:"only_b"`
+		Metrics     []struct {
+			Metric      string          `json:"metric"`
+			Similarity  float64         `json:"similarity"`
+			Explanation json.RawMessage `json:"explanation"`
+		} `json:"metrics"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// The login scenarios only differ in who logs in
+	if res.TestA.Test != pair.TestA || len(res.TestA.Steps) != 3 {
+		t.Errorf("Unexpected test A: %+v", res.TestA)
+	}
+	if len(res.Diff) != 4 || res.Diff[1].Op != AlignGapB || res.Diff[2].Op != AlignGapA {
+		t.Errorf("Unexpected diff: %+v", res.Diff)
+	}
+	if len(res.SharedSteps) != 2 || len(res.OnlyA) != 1 || len(res.OnlyB) != 1 {
+		t.Errorf("Expected 2 shared steps and 1 on each side, got %v, %v and %v", res.SharedSteps, res.OnlyA, res.OnlyB)
+	}
+
+	if len(res.Metrics) != 4 {
+		t.Fatalf("Expected 4 metrics, got %d", len(res.Metrics))
+	}
+	var lcs LCSExplanation
+	if err := json.Unmarshal(res.Metrics[0].Explanation, &lcs); err != nil || lcs.Common != 2 || lcs.Union != 4 || res.Metrics[0].Similarity != pair.Similarity {
+		t.Errorf("Unexpected LCS breakdown: %s (%v)", res.Metrics[0].Explanation, err)
+	}
+	var sets SetOverlapExplanation
+	if err := json.Unmarshal(res.Metrics[1].Explanation, &sets); err != nil || sets.Intersection != 2 || sets.Union != 4 {
+		t.Errorf("Unexpected Jaccard breakdown: %s (%v)", res.Metrics[1].Explanation, err)
+	}
+	// Detailed metrics give their details, the others only their score
+	if len(res.Metrics[2].Explanation) == 0 || len(res.Metrics[3].Explanation) != 0 {
+		t.Errorf("Expected edit distance details and no LSA breakdown, got %s and %s", res.Metrics[2].Explanation, res.Metrics[3].Explanation)
+	}
+
+	for _, test := range []struct {
+		query    url.Values
+		expected int
+	}{
+		{url.Values{"directory": {dir}, "a": {pair.TestA}}, http.StatusBadRequest},
+		{url.Values{"directory": {dir}, "granularity": {"scenario"}, "a": {pair.TestA}, "b": {"missing.feature"}}, http.StatusNotFound},
+		{url.Values{"directory": {dir}, "a": {pair.TestA}, "b": {pair.TestB}, "metrics": {"unknown"}}, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("GET", "/api/similarity-reports/explain?"+test.query.Encode(), nil)
+		rr := httptest.NewRecorder()
+		GetSimilarityExplanation(rr, req)
+		if rr.Code != test.expected {
+			t.Errorf("Expected status code %d for %v, got %d", test.expected, test.query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"container/heap"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// FilterOptions trim each report while it is computed, so pairs that are dropped are never held in memory
+type FilterOptions struct {
+	MinSimilarity float64 // Drop comparisons scoring below this
+	TopK          int     // Keep only the K best comparisons of each test, 0 keeps every comparison
+	Sort          string  // "desc" or "asc" sorts each report by similarity, "" keeps the pair order
+}
+
+// Read min_similarity, top_k and metric_sort from the query
+func filterFromQuery(query url.Values) (FilterOptions, error) {
+	var opts FilterOptions
+	if value := query.Get("min_similarity"); value != "" {
+		minSimilarity, err := strconv.ParseFloat(value, 64)
+		if err != nil || minSimilarity < 0 || minSimilarity > 1 {
+			return opts, fmt.Errorf("invalid min_similarity %q (expected a number between 0 and 1)", value)
+		}
+		opts.MinSimilarity = minSimilarity
+	}
+	if value := query.Get("top_k"); value != "" {
+		topK, err := strconv.Atoi(value)
+		if err != nil || topK < 0 {
+			return opts, fmt.Errorf("invalid top_k %q (expected a non-negative integer)", value)
+		}
+		opts.TopK = topK
+	}
+	switch sortOrder := query.Get("metric_sort"); sortOrder {
+	case "", "desc", "asc":
+		opts.Sort = sortOrder
+	default:
+		return opts, fmt.Errorf("unknown metric_sort %q (expected desc or asc)", sortOrder)
+	}
+	return opts, nil
+}
+
+// A comparison kept by the top-K filter, shared by the heaps of both its tests
+type keptComparison struct {
+	seq   int // Position in the pair order, used to restore it and to break ties
+	entry ComparisonEntry
+}
+
+// Min-heap of a test's best comparisons, with the weakest (and among equals the latest) on top
+type comparisonHeap []*keptComparison
+
+func (h comparisonHeap) Len() int { return len(h) }
+func (h comparisonHeap) Less(i, j int) bool {
+	if h[i].entry.Similarity != h[j].entry.Similarity {
+		return h[i].entry.Similarity < h[j].entry.Similarity
+	}
+	return h[i].seq > h[j].seq
+}
+func (h comparisonHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *comparisonHeap) Push(x any)   { *h = append(*h, x.(*keptComparison)) }
+func (h *comparisonHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// comparisonFilter collects the comparisons of one metric that pass the filter.
+// With top_k a comparison is kept while it is among the K best of either of its tests.
+type comparisonFilter struct {
+	opts  FilterOptions
+	seq   int
+	kept  []ComparisonEntry
+	heaps []comparisonHeap // One per test, only used with top_k
+}
+
+func newComparisonFilter(opts FilterOptions, tests int) *comparisonFilter {
+	filter := &comparisonFilter{opts: opts, kept: []ComparisonEntry{}}
+	if opts.TopK > 0 {
+		filter.heaps = make([]comparisonHeap, tests)
+	}
+	return filter
+}
+
+// Add offers the comparison of tests i and j to the filter
+func (f *comparisonFilter) Add(i, j int, entry ComparisonEntry) {
+	seq := f.seq
+	f.seq++
+	if entry.Similarity < f.opts.MinSimilarity {
+		return
+	}
+	if f.heaps == nil {
+		f.kept = append(f.kept, entry)
+		return
+	}
+
+	kept := &keptComparison{seq: seq, entry: entry}
+	for _, test := range []int{i, j} {
+		h := &f.heaps[test]
+		if h.Len() < f.opts.TopK {
+			heap.Push(h, kept)
+			continue
+		}
+		if weakest := (*h)[0]; (comparisonHeap{weakest, kept}).Less(0, 1) {
+			(*h)[0] = kept
+			heap.Fix(h, 0)
+		}
+	}
+}
+
+// Results returns the kept comparisons in pair order, or sorted by similarity when requested
+func (f *comparisonFilter) Results() []ComparisonEntry {
+	results := f.kept
+	if f.heaps != nil {
+		var kept []*keptComparison
+		seen := make(map[*keptComparison]bool)
+		for _, h := range f.heaps {
+			for _, comparison := range h {
+				if !seen[comparison] {
+					seen[comparison] = true
+					kept = append(kept, comparison)
+				}
+			}
+		}
+		sort.Slice(kept, func(a, b int) bool { return kept[a].seq < kept[b].seq })
+		results = make([]ComparisonEntry, len(kept))
+		for k, comparison := range kept {
+			results[k] = comparison.entry
+		}
+	}
+
+	switch f.opts.Sort {
+	case "desc":
+		sort.SliceStable(results, func(a, b int) bool { return results[a].Similarity > results[b].Similarity })
+	case "asc":
+		sort.SliceStable(results, func(a, b int) bool { return results[a].Similarity < results[b].Similarity })
+	}
+	return results
+}
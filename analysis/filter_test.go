@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestComparisonFilter(t *testing.T) {
+	scores := []struct {
+		i, j       int
+		similarity float64
+	}{
+		{0, 1, 0.9}, {0, 2, 0.1}, {0, 3, 0.5}, {1, 2, 0.2}, {1, 3, 0.3}, {2, 3, 0.4},
+	}
+
+	tests := []struct {
+		opts     FilterOptions
+		expected []float64
+	}{
+		{FilterOptions{}, []float64{0.9, 0.1, 0.5, 0.2, 0.3, 0.4}},
+		{FilterOptions{MinSimilarity: 0.35}, []float64{0.9, 0.5, 0.4}},
+		{FilterOptions{Sort: "desc"}, []float64{0.9, 0.5, 0.4, 0.3, 0.2, 0.1}},
+		{FilterOptions{MinSimilarity: 0.25, Sort: "asc"}, []float64{0.3, 0.4, 0.5, 0.9}},
+		// The best comparison of each test: 0 and 1 share 0.9, 2 has 0.4 and 3 has 0.5
+		{FilterOptions{TopK: 1}, []float64{0.9, 0.5, 0.4}},
+		{FilterOptions{TopK: 1, MinSimilarity: 0.45}, []float64{0.9, 0.5}},
+		{FilterOptions{TopK: 2, Sort: "desc"}, []float64{0.9, 0.5, 0.4, 0.3, 0.2}},
+	}
+
+	for _, test := range tests {
+		filter := newComparisonFilter(test.opts, 4)
+		for _, score := range scores {
+			filter.Add(score.i, score.j, ComparisonEntry{Similarity: score.similarity})
+		}
+		results := filter.Results()
+
+		var similarities []float64
+		for _, result := range results {
+			similarities = append(similarities, result.Similarity)
+		}
+		if len(similarities) != len(test.expected) {
+			t.Errorf("%+v: expected %v, got %v", test.opts, test.expected, similarities)
+			continue
+		}
+		for k := range similarities {
+			if similarities[k] != test.expected[k] {
+				t.Errorf("%+v: expected %v, got %v", test.opts, test.expected, similarities)
+				break
+			}
+		}
+	}
+}
+
+func TestGetSimilarityReportsFilters(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature, "search.feature": searchFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"scenario"}, "metrics": {"jaccard"}, "top_k": {"1"}, "metric_sort": {"desc"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports map[string]SimilarityReport `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// Both login scenarios are each other's nearest neighbour, the search scenario's best match is the admin login
+	comparisons := res.Reports["jaccard"].Comparisons
+	if len(comparisons) != 2 || comparisons[0].Similarity < comparisons[1].Similarity {
+		t.Fatalf("Unexpected comparisons: %+v", comparisons)
+	}
+	if comparisons[0].RefA.Scenario != "Admin logs in" || comparisons[0].RefB.Scenario != "Guest logs in" {
+		t.Errorf("Unexpected best comparison: %+v", comparisons[0])
+	}
+
+	for _, query := range []url.Values{
+		{"min_similarity": {"2"}},
+		{"top_k": {"-1"}},
+		{"metric_sort": {"random"}},
+	} {
+		query.Set("directory", dir)
+		if rr := getSimilarityReports(t, query); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code 400 for %v, got %d", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultSoftThreshold is the lowest step similarity counted as a partial match
+const DefaultSoftThreshold = 0.5
+
+// StepMatcher scores how alike two individual steps are, from 0 to 1
+type StepMatcher func(x, y string) float64
+
+// StepSimilarity averages the word overlap and the character trigram overlap of two steps,
+// so `I click the login button` and `I click on the login button` score highly
+func StepSimilarity(x, y string) float64 {
+	if x == y {
+		return 1
+	}
+	x, y = strings.ToLower(x), strings.ToLower(y)
+	tokens := JaccardIndex(strings.Fields(x), strings.Fields(y))
+	trigrams := JaccardIndex(trigramsOf(x), trigramsOf(y))
+	return (tokens + trigrams) / 2
+}
+
+// Character trigrams of a step with its whitespace collapsed and padded so word boundaries count
+func trigramsOf(text string) []string {
+	runes := []rune(" " + strings.Join(strings.Fields(text), " ") + " ")
+	var trigrams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		trigrams = append(trigrams, string(runes[i:i+3]))
+	}
+	return trigrams
+}
+
+// SoftMatch scores steps with StepSimilarity, treating anything below the threshold as unrelated
+func SoftMatch(threshold float64) StepMatcher {
+	return func(x, y string) float64 {
+		similarity := StepSimilarity(x, y)
+		if similarity < threshold {
+			return 0
+		}
+		return similarity
+	}
+}
+
+// SoftCosineSimilarity is the cosine of the step count vectors, where partially matching steps
+// contribute to each other's dimension by their match score
+func SoftCosineSimilarity(testA, testB []string, match StepMatcher) float64 {
+	countA, countB := stepCounts(testA), stepCounts(testB)
+	steps := sortedSteps(countA, countB)
+
+	// Similarity of every pair of distinct steps, computed once
+	scores := make([][]float64, len(steps))
+	for i := range steps {
+		scores[i] = make([]float64, len(steps))
+		for j := range steps {
+			if i == j {
+				scores[i][j] = 1
+			} else if j < i {
+				scores[i][j] = scores[j][i]
+			} else {
+				scores[i][j] = match(steps[i], steps[j])
+			}
+		}
+	}
+
+	product := func(x, y map[string]int) float64 {
+		total := 0.0
+		for i, stepI := range steps {
+			if x[stepI] == 0 {
+				continue
+			}
+			for j, stepJ := range steps {
+				total += float64(x[stepI]) * float64(y[stepJ]) * scores[i][j]
+			}
+		}
+		return total
+	}
+
+	magA, magB := product(countA, countA), product(countB, countB)
+	if magA == 0 || magB == 0 {
+		return 0.0 // If either test has no steps, similarity is undefined, return 0
+	}
+	return math.Min(1, product(countA, countB)/(math.Sqrt(magA)*math.Sqrt(magB)))
+}
+
+// FuzzyJaccardIndex pairs the distinct steps of both tests, best matches first, and counts
+// each pair by its match score in the intersection
+func FuzzyJaccardIndex(setA, setB []string, match StepMatcher) float64 {
+	stepsA, stepsB := sortedSteps(stepCounts(setA)), sortedSteps(stepCounts(setB))
+
+	type pair struct {
+		a, b  int
+		score float64
+	}
+	var pairs []pair
+	for i, stepA := range stepsA {
+		for j, stepB := range stepsB {
+			if score := match(stepA, stepB); score > 0 {
+				pairs = append(pairs, pair{i, j, score})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].score > pairs[j].score })
+
+	intersection := 0.0
+	usedA, usedB := make([]bool, len(stepsA)), make([]bool, len(stepsB))
+	for _, p := range pairs {
+		if usedA[p.a] || usedB[p.b] {
+			continue
+		}
+		usedA[p.a], usedB[p.b] = true, true
+		intersection += p.score
+	}
+
+	union := float64(len(stepsA)+len(stepsB)) - intersection
+	if union == 0 {
+		return 0.0 // Two empty tests have nothing to compare
+	}
+	return intersection / union
+}
+
+// FuzzyLCSSimilarity is LCSSimilarity where aligned steps count by their match score instead of only when equal
+func FuzzyLCSSimilarity(testA, testB []string, match StepMatcher) float64 {
+	m, n := len(testA), len(testB)
+	dp := make([][]float64, m+1)
+	for i := range dp {
+		dp[i] = make([]float64, n+1)
+	}
+	for i := 1; i <= m; i++ {
+		for j := 1; j <= n; j++ {
+			dp[i][j] = math.Max(dp[i-1][j], dp[i][j-1])
+			if score := match(testA[i-1], testB[j-1]); score > 0 {
+				dp[i][j] = math.Max(dp[i][j], dp[i-1][j-1]+score)
+			}
+		}
+	}
+
+	lcs := dp[m][n]
+	total := float64(m+n) - lcs
+	if total == 0 {
+		return 0.0 // Two empty tests have nothing to compare
+	}
+	return lcs / total
+}
+
+func stepCounts(steps []string) map[string]int {
+	counts := make(map[string]int)
+	for _, step := range steps {
+		counts[step]++
+	}
+	return counts
+}
+
+// Distinct steps of the count maps in sorted order, so scores don't depend on map iteration
+func sortedSteps(counts ...map[string]int) []string {
+	seen := make(map[string]bool)
+	var steps []string
+	for _, count := range counts {
+		for step := range count {
+			if !seen[step] {
+				seen[step] = true
+				steps = append(steps, step)
+			}
+		}
+	}
+	sort.Strings(steps)
+	return steps
+}
+
+// FuzzyMetric is a metric that soft-matches steps, with a per-request minimum step match threshold
+type FuzzyMetric struct {
+	name       string
+	label      string
+	Threshold  float64
+	similarity func(a, b []string, match StepMatcher) float64
+}
+
+// NewFuzzyMetric wraps a soft-matching similarity function as a SimilarityMetric
+func NewFuzzyMetric(name, label string, similarity func(a, b []string, match StepMatcher) float64) FuzzyMetric {
+	return FuzzyMetric{name: name, label: label, Threshold: DefaultSoftThreshold, similarity: similarity}
+}
+
+func (m FuzzyMetric) Name() string  { return m.name }
+func (m FuzzyMetric) Label() string { return m.label }
+
+func (m FuzzyMetric) Similarity(a, b []string) float64 {
+	return m.similarity(a, b, SoftMatch(m.Threshold))
+}
+
+// Configure reads soft_threshold, a step similarity between 0 and 1, from the query
+func (m FuzzyMetric) Configure(query url.Values) (SimilarityMetric, error) {
+	value := query.Get("soft_threshold")
+	if value == "" {
+		return m, nil
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		return nil, fmt.Errorf("invalid soft_threshold %q (expected a number between 0 and 1)", value)
+	}
+	m.Threshold = threshold
+	return m, nil
+}
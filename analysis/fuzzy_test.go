@@ -0,0 +1,92 @@
+package analysis
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestStepSimilarity(t *testing.T) {
+	reworded := StepSimilarity("I click the login button", "I click on the login button")
+	unrelated := StepSimilarity("I click the login button", "the basket is empty")
+
+	if StepSimilarity("I log in", "I log in") != 1 {
+		t.Errorf("Expected identical steps to score 1")
+	}
+	if reworded < 0.7 {
+		t.Errorf("Expected reworded steps to score at least 0.7, got %f", reworded)
+	}
+	if unrelated > 0.2 {
+		t.Errorf("Expected unrelated steps to score at most 0.2, got %f", unrelated)
+	}
+	if SoftMatch(0.5)("I click the login button", "the basket is empty") != 0 {
+		t.Errorf("Expected matches below the threshold to score 0")
+	}
+}
+
+func TestFuzzyMetrics(t *testing.T) {
+	a := []string{"I am on the login page", "I click the login button", "I see the dashboard"}
+	b := []string{"I am on the login page", "I click on the login button", "I see the dashboard"}
+	match := SoftMatch(DefaultSoftThreshold)
+
+	tests := []struct {
+		name  string
+		fuzzy func(a, b []string, match StepMatcher) float64
+		exact func(a, b []string) float64
+	}{
+		{"soft_cosine", SoftCosineSimilarity, CosineSimilarity},
+		{"fuzzy_jaccard", FuzzyJaccardIndex, JaccardIndex},
+		{"fuzzy_lcs", FuzzyLCSSimilarity, LCSSimilarity},
+	}
+
+	for _, test := range tests {
+		// The reworded step counts as a partial match
+		if fuzzy, exact := test.fuzzy(a, b, match), test.exact(a, b); fuzzy <= exact || fuzzy >= 1 {
+			t.Errorf("%s: expected a score between %f and 1, got %f", test.name, exact, fuzzy)
+		}
+		if result := test.fuzzy(a, a, match); math.Abs(result-1) > 1e-9 {
+			t.Errorf("%s: expected identical tests to score 1, got %f", test.name, result)
+		}
+		if result := test.fuzzy(nil, nil, match); result != 0 {
+			t.Errorf("%s: expected empty tests to score 0, got %f", test.name, result)
+		}
+		// With a threshold of 1 only identical steps match
+		if fuzzy, exact := test.fuzzy(a, b, SoftMatch(1)), test.exact(a, b); math.Abs(fuzzy-exact) > 1e-9 {
+			t.Errorf("%s: expected %f with an exact threshold, got %f", test.name, exact, fuzzy)
+		}
+	}
+}
+
+func TestGetSimilarityReportsSoftThreshold(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	scores := make(map[string]float64)
+	for _, threshold := range []string{"0.5", "1"} {
+		rr := getSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"scenario"}, "metrics": {"fuzzy_jaccard"}, "soft_threshold": {threshold}})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var res struct {
+			Reports map[string]SimilarityReport `json:"reports"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		scores[threshold] = res.Reports["fuzzy_jaccard"].Comparisons[0].Similarity
+	}
+
+	// The login steps differ only in the user, which an exact threshold no longer matches
+	if scores["1"] != 0.5 {
+		t.Errorf("Expected 0.5 with an exact threshold, got %f", scores["1"])
+	}
+	if scores["0.5"] <= scores["1"] {
+		t.Errorf("Expected a soft threshold to score higher, got %f", scores["0.5"])
+	}
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "metrics": {"soft_cosine"}, "soft_threshold": {"1.5"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// DefaultLSADims is the number of latent dimensions kept from the SVD
+const DefaultLSADims = 100
+
+const (
+	lsaOversampling    = 10 // Extra random directions sampled beyond the dimensions kept
+	lsaPowerIterations = 2  // Passes that sharpen the sampled range towards the strongest singular vectors
+)
+
+// LSAModel projects tests into the latent space of a truncated SVD of the suite's term-document matrix
+type LSAModel struct {
+	terms map[string]int
+	idf   []float64
+	basis *mat.Dense // Term x dimension matrix: the first k left singular vectors
+	dims  int
+}
+
+// Words of every step, lower-cased; these are the terms of the matrix
+func stepTerms(steps []string) []string {
+	var terms []string
+	for _, step := range steps {
+		terms = append(terms, strings.Fields(strings.ToLower(step))...)
+	}
+	return terms
+}
+
+// NewLSAModel builds a sparse TF-IDF weighted term-document matrix with one column per test
+// and keeps the dims strongest singular vectors. It returns nil when the corpus has no terms.
+func NewLSAModel(corpus [][]string, dims int) *LSAModel {
+	model := &LSAModel{terms: make(map[string]int)}
+	documents := make([][]string, len(corpus))
+	var frequency []int
+	for d, steps := range corpus {
+		documents[d] = stepTerms(steps)
+		seen := make(map[int]bool)
+		for _, term := range documents[d] {
+			index, found := model.terms[term]
+			if !found {
+				index = len(model.terms)
+				model.terms[term] = index
+				frequency = append(frequency, 0)
+			}
+			if !seen[index] {
+				seen[index] = true
+				frequency[index]++
+			}
+		}
+	}
+	if len(model.terms) == 0 || len(corpus) == 0 {
+		return nil
+	}
+
+	model.idf = make([]float64, len(model.terms))
+	for index, df := range frequency {
+		model.idf[index] = math.Log(float64(len(corpus)+1)/float64(df+1)) + 1
+	}
+
+	matrix := termDocumentMatrix{rows: len(model.terms), columns: make([][]termWeight, len(corpus))}
+	for d, terms := range documents {
+		matrix.columns[d] = model.weights(terms)
+	}
+
+	u, values, ok := truncatedSVD(matrix, dims)
+	if !ok {
+		return nil
+	}
+
+	// Dimensions with no weight left carry no information
+	model.dims = min(dims, len(values))
+	for model.dims > 1 && values[model.dims-1] < 1e-10 {
+		model.dims--
+	}
+	model.basis = mat.DenseCopyOf(u.Slice(0, len(model.terms), 0, model.dims))
+	return model
+}
+
+// Log-scaled term frequency weighted by IDF, by term index; terms the model has not seen are dropped
+func (m *LSAModel) weights(terms []string) []termWeight {
+	counts := make(map[int]int)
+	for _, term := range terms {
+		if index, found := m.terms[term]; found {
+			counts[index]++
+		}
+	}
+	weights := make([]termWeight, 0, len(counts))
+	for index, count := range counts {
+		weights = append(weights, termWeight{term: index, weight: (1 + math.Log(float64(count))) * m.idf[index]})
+	}
+	sort.Slice(weights, func(i, j int) bool { return weights[i].term < weights[j].term })
+	return weights
+}
+
+func (m *LSAModel) vector(terms []string) []float64 {
+	vector := make([]float64, len(m.terms))
+	for _, entry := range m.weights(terms) {
+		vector[entry.term] = entry.weight
+	}
+	return vector
+}
+
+type termWeight struct {
+	term   int
+	weight float64
+}
+
+// Sparse term-document matrix: tests only use a handful of the suite's words
+type termDocumentMatrix struct {
+	rows    int
+	columns [][]termWeight // The weighted terms of each test
+}
+
+// Product with x, a dense matrix with one row per test
+func (a termDocumentMatrix) mul(x *mat.Dense) *mat.Dense {
+	_, cols := x.Dims()
+	result := mat.NewDense(a.rows, cols, nil)
+	for d, column := range a.columns {
+		row := x.RawRowView(d)
+		for _, entry := range column {
+			out := result.RawRowView(entry.term)
+			for c, value := range row {
+				out[c] += entry.weight * value
+			}
+		}
+	}
+	return result
+}
+
+// Product of the transpose with y, a dense matrix with one row per term
+func (a termDocumentMatrix) mulTrans(y *mat.Dense) *mat.Dense {
+	_, cols := y.Dims()
+	result := mat.NewDense(len(a.columns), cols, nil)
+	for d, column := range a.columns {
+		out := result.RawRowView(d)
+		for _, entry := range column {
+			for c, value := range y.RawRowView(entry.term) {
+				out[c] += entry.weight * value
+			}
+		}
+	}
+	return result
+}
+
+// Randomized truncated SVD (Halko, Martinsson and Tropp): the range of the matrix is sampled with a few more
+// random directions than needed, and only the small projection of the matrix onto that range is decomposed.
+// It never builds the dense matrix, so time and memory grow with the words used and (terms + tests) x dims.
+// It returns the left singular vectors and the singular values, strongest first.
+func truncatedSVD(a termDocumentMatrix, dims int) (*mat.Dense, []float64, bool) {
+	// Sampling every direction recovers the matrix exactly, so small suites get the full decomposition
+	samples := min(dims+lsaOversampling, a.rows, len(a.columns))
+
+	// A fixed seed keeps the reports reproducible
+	random := rand.New(rand.NewPCG(1, 2))
+	omega := mat.NewDense(len(a.columns), samples, nil)
+	for i := range len(a.columns) {
+		for j := range samples {
+			omega.Set(i, j, random.NormFloat64())
+		}
+	}
+	q := a.mul(omega)
+	orthonormalize(q)
+	for range lsaPowerIterations {
+		z := a.mulTrans(q)
+		orthonormalize(z)
+		q = a.mul(z)
+		orthonormalize(q)
+	}
+
+	// Q^T A has one row per sample, so its SVD is cheap
+	var svd mat.SVD
+	if !svd.Factorize(a.mulTrans(q).T(), mat.SVDThinU) {
+		return nil, nil, false
+	}
+	var small mat.Dense
+	svd.UTo(&small)
+	var u mat.Dense
+	u.Mul(q, &small)
+	return &u, svd.Values(nil), true
+}
+
+// Orthonormalise the columns of m in place with modified Gram-Schmidt, run twice so rounding errors do not pile up.
+// Columns that depend on the ones before them are zeroed.
+func orthonormalize(m *mat.Dense) {
+	_, cols := m.Dims()
+	for range 2 {
+		for j := range cols {
+			v := m.ColView(j).(*mat.VecDense)
+			norm := mat.Norm(v, 2)
+			for i := range j {
+				previous := m.ColView(i)
+				v.AddScaledVec(v, -mat.Dot(v, previous), previous)
+			}
+			if remaining := mat.Norm(v, 2); remaining <= 1e-10*norm || remaining == 0 {
+				v.Zero()
+			} else {
+				v.ScaleVec(1/remaining, v)
+			}
+		}
+	}
+}
+
+// Project folds a test into the latent space
+func (m *LSAModel) Project(steps []string) []float64 {
+	var projected mat.VecDense
+	projected.MulVec(m.basis.T(), mat.NewVecDense(len(m.terms), m.vector(stepTerms(steps))))
+	return projected.RawVector().Data
+}
+
+// Similarity is the cosine of two tests in the latent space
+func (m *LSAModel) Similarity(a, b []string) float64 {
+	return latentCosine(m.Project(a), m.Project(b))
+}
+
+// Cosine of two latent vectors, with opposite directions counted as unrelated
+func latentCosine(x, y []float64) float64 {
+	dotProduct, magA, magB := 0.0, 0.0, 0.0
+	for i := range x {
+		dotProduct += x[i] * y[i]
+		magA += x[i] * x[i]
+		magB += y[i] * y[i]
+	}
+	if magA == 0 || magB == 0 {
+		return 0.0 // A test with no known terms has nothing to compare
+	}
+	return math.Max(0, math.Min(1, dotProduct/(math.Sqrt(magA)*math.Sqrt(magB))))
+}
+
+// LSAMetric compares tests in the latent space of the suite they belong to.
+// Fitting runs the SVD; each test is projected once and reused across its pairs.
+type LSAMetric struct {
+	Dims      int
+	model     *LSAModel
+	projected map[string][]float64
+}
+
+func (m LSAMetric) Name() string  { return "lsa" }
+func (m LSAMetric) Label() string { return "Latent Semantic Similarity" }
+
+func (m LSAMetric) Similarity(a, b []string) float64 {
+	model := m.model
+	if model == nil {
+		// Not fitted, so the pair is its own corpus
+		if model = NewLSAModel([][]string{a, b}, m.Dims); model == nil {
+			return 0.0
+		}
+		return model.Similarity(a, b)
+	}
+
+	return latentCosine(m.projection(a), m.projection(b))
+}
+
+// Projection of the fitted tests from the cache, folding in anything else such as templates
+func (m LSAMetric) projection(steps []string) []float64 {
+	if projected, found := m.projected[strings.Join(steps, "\n")]; found {
+		return projected
+	}
+	return m.model.Project(steps)
+}
+
+func (m LSAMetric) Fit(corpus [][]string) SimilarityMetric {
+	m.model = NewLSAModel(corpus, m.Dims)
+	m.projected = make(map[string][]float64, len(corpus))
+	if m.model != nil {
+		for _, steps := range corpus {
+			m.projected[strings.Join(steps, "\n")] = m.model.Project(steps)
+		}
+	}
+	return m
+}
+
+// Configure reads lsa_dims, the number of latent dimensions, from the query
+func (m LSAMetric) Configure(query url.Values) (SimilarityMetric, error) {
+	value := query.Get("lsa_dims")
+	if value == "" {
+		return m, nil
+	}
+	dims, err := strconv.Atoi(value)
+	if err != nil || dims < 1 {
+		return nil, fmt.Errorf("invalid lsa_dims %q (expected a positive integer)", value)
+	}
+	m.Dims = dims
+	return m, nil
+}
@@ -0,0 +1,100 @@
+package analysis
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestLSAMetric(t *testing.T) {
+	loginA := []string{"I click the login button", "I enter my password"}
+	loginB := []string{"I press the login button", "I type my password"}
+	search := []string{"I search for shoes", "I filter the results by size"}
+	corpus := [][]string{loginA, loginB, search, {"I search for boots", "I sort the results by price"}}
+
+	metric := LSAMetric{Dims: 2}.Fit(corpus)
+
+	// The paraphrased login steps share most of their vocabulary, so they end up close in the latent space
+	if exact := CosineSimilarity(loginA, loginB); exact != 0 {
+		t.Fatalf("Expected no exact overlap, got %f", exact)
+	}
+	if paraphrased := metric.Similarity(loginA, loginB); paraphrased < 0.8 {
+		t.Errorf("Expected paraphrased tests to score at least 0.8, got %f", paraphrased)
+	}
+	if unrelated := metric.Similarity(loginA, search); unrelated > 0.3 {
+		t.Errorf("Expected unrelated tests to score at most 0.3, got %f", unrelated)
+	}
+	if identical := metric.Similarity(search, search); math.Abs(identical-1) > 1e-9 {
+		t.Errorf("Expected identical tests to score 1, got %f", identical)
+	}
+	// Tests outside the corpus are folded in
+	if folded := metric.Similarity([]string{"I click the login button"}, loginA); folded < 0.8 {
+		t.Errorf("Expected a folded in test to score at least 0.8, got %f", folded)
+	}
+	if empty := metric.Similarity(nil, loginA); empty != 0 {
+		t.Errorf("Expected an empty test to score 0, got %f", empty)
+	}
+}
+
+func TestTruncatedSVD(t *testing.T) {
+	// 300 terms by 120 tests mixing 6 topics of 10 words: far larger than the 8 + 10 directions sampled, but of rank 6
+	random := rand.New(rand.NewPCG(3, 4))
+	matrix := termDocumentMatrix{rows: 300, columns: make([][]termWeight, 120)}
+	dense := mat.NewDense(300, 120, nil)
+	for d := range matrix.columns {
+		for topic := range 6 {
+			strength := random.Float64()
+			for word := range 10 {
+				term := topic*50 + word
+				matrix.columns[d] = append(matrix.columns[d], termWeight{term: term, weight: strength * float64(word+1)})
+				dense.Set(term, d, strength*float64(word+1))
+			}
+		}
+	}
+
+	u, values, ok := truncatedSVD(matrix, 8)
+	var exact mat.SVD
+	if !ok || !exact.Factorize(dense, mat.SVDNone) {
+		t.Fatalf("Expected both decompositions to succeed")
+	}
+	if rows, cols := u.Dims(); rows != 300 || cols != 18 {
+		t.Errorf("Expected 300 x 18 singular vectors, got %d x %d", rows, cols)
+	}
+	for k, expected := range exact.Values(nil)[:8] {
+		if math.Abs(values[k]-expected) > 1e-6*math.Max(1, expected) {
+			t.Errorf("Expected singular value %d to be %f, got %f", k, expected, values[k])
+		}
+	}
+}
+
+func TestGetSimilarityReportsLSA(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature, "search.feature": searchFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"scenario"}, "metrics": {"lsa"}, "lsa_dims": {"2"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports map[string]SimilarityReport `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// The two login scenarios are the closest pair
+	comparisons := res.Reports["lsa"].Comparisons
+	if len(comparisons) != 3 || comparisons[0].Similarity <= comparisons[1].Similarity || comparisons[0].Similarity <= comparisons[2].Similarity {
+		t.Errorf("Unexpected comparisons: %+v", comparisons)
+	}
+
+	rr = getSimilarityReports(t, url.Values{"directory": {dir}, "metrics": {"lsa"}, "lsa_dims": {"0"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,262 @@
+package analysis
+
+import (
+	"fmt"
+	"hash/fnv"
+	"iter"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// LSH defaults: 128 MinHash values split into bands to find pairs with a Jaccard index of about 0.5 or more
+const (
+	DefaultLSHHashes    = 128
+	DefaultLSHThreshold = 0.5
+	MaxLSHHashes        = 1024 // Most MinHash values per test, lsh_bands x lsh_rows, a request may ask for
+)
+
+// CandidateOptions choose which pairs of tests go through the exact metrics
+type CandidateOptions struct {
+	Method    string  // "all" compares every pair, "lsh" only the pairs found by MinHash banding
+	Threshold float64 // Jaccard index the LSH bands are tuned for
+	Bands     int
+	Rows      int // MinHash values per band
+}
+
+// CandidateSummary reports how LSH candidates were found, so the speed and recall trade-off is visible
+type CandidateSummary struct {
+	Method             string  `json:"method"`
+	Threshold          float64 `json:"threshold"`
+	Bands              int     `json:"bands"`
+	Rows               int     `json:"rows"`
+	Hashes             int     `json:"hashes"`
+	EffectiveThreshold float64 `json:"effective_threshold"` // Jaccard index where a pair has even odds of becoming a candidate
+	RecallAtThreshold  float64 `json:"recall_at_threshold"` // Chance a pair exactly at the threshold becomes a candidate
+	CandidatePairs     int     `json:"candidate_pairs"`
+	TotalPairs         int     `json:"total_pairs"`
+}
+
+// Read candidates=all|lsh with lsh_threshold, lsh_bands and lsh_rows from the query.
+// When the bands and rows are not both given they are derived from the threshold and DefaultLSHHashes.
+func candidatesFromQuery(query url.Values) (CandidateOptions, error) {
+	opts := CandidateOptions{Method: query.Get("candidates"), Threshold: DefaultLSHThreshold}
+	switch opts.Method {
+	case "", "all":
+		opts.Method = "all"
+		return opts, nil
+	case "lsh":
+	default:
+		return opts, fmt.Errorf("unknown candidates %q (expected all or lsh)", opts.Method)
+	}
+
+	if value := query.Get("lsh_threshold"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			return opts, fmt.Errorf("invalid lsh_threshold %q (expected a number above 0 and at most 1)", value)
+		}
+		opts.Threshold = threshold
+	}
+	for key, target := range map[string]*int{"lsh_bands": &opts.Bands, "lsh_rows": &opts.Rows} {
+		if value := query.Get(key); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > MaxLSHHashes {
+				return opts, fmt.Errorf("invalid %s %q (expected a positive integer up to %d)", key, value, MaxLSHHashes)
+			}
+			*target = parsed
+		}
+	}
+
+	switch {
+	case opts.Bands > 0 && opts.Rows > 0:
+	case opts.Bands > 0:
+		opts.Rows = max(1, DefaultLSHHashes/opts.Bands)
+	case opts.Rows > 0:
+		opts.Bands = max(1, DefaultLSHHashes/opts.Rows)
+	default:
+		opts.Bands, opts.Rows = bandsForThreshold(opts.Threshold, DefaultLSHHashes)
+	}
+	// Every test keeps a signature of bands x rows hashes
+	if opts.Bands*opts.Rows > MaxLSHHashes {
+		return opts, fmt.Errorf("lsh_bands x lsh_rows is %d (expected at most %d)", opts.Bands*opts.Rows, MaxLSHHashes)
+	}
+	return opts, nil
+}
+
+// Pick the band layout whose S-curve midpoint (1/b)^(1/r) is closest to the threshold
+func bandsForThreshold(threshold float64, hashes int) (bands, rows int) {
+	best := math.Inf(1)
+	for r := 1; r <= hashes; r++ {
+		b := hashes / r
+		if distance := math.Abs(effectiveThreshold(b, r) - threshold); distance < best {
+			best, bands, rows = distance, b, r
+		}
+	}
+	return bands, rows
+}
+
+func effectiveThreshold(bands, rows int) float64 {
+	return math.Pow(1/float64(bands), 1/float64(rows))
+}
+
+// Chance that two sets with the given Jaccard index share at least one band
+func candidateProbability(jaccard float64, bands, rows int) float64 {
+	return 1 - math.Pow(1-math.Pow(jaccard, float64(rows)), float64(bands))
+}
+
+// MinHashSignature is the minimum of each of n seeded hashes over the distinct steps of a test.
+// Two signatures agree at a position with probability equal to the Jaccard index of their steps.
+func MinHashSignature(steps []string, n int) []uint64 {
+	if len(steps) == 0 {
+		return nil
+	}
+	signature := make([]uint64, n)
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+	for step := range stepCounts(steps) {
+		base := hashString(step)
+		for i := range signature {
+			if h := mix64(base ^ mix64(uint64(i)+1)); h < signature[i] {
+				signature[i] = h
+			}
+		}
+	}
+	return signature
+}
+
+func hashString(text string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	return h.Sum64()
+}
+
+// SplitMix64 finaliser, spreads the bits of a hash so every seed gives an independent permutation
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// LSHCandidates returns the pairs (i < j) of step sequences whose MinHash signatures share at least one band,
+// in the same order as the exhaustive loop
+func LSHCandidates(corpus [][]string, bands, rows int) [][2]int {
+	signatures := make([][]uint64, len(corpus))
+	for i, steps := range corpus {
+		signatures[i] = MinHashSignature(steps, bands*rows)
+	}
+
+	seen := make(map[[2]int]bool)
+	var pairs [][2]int
+	for band := 0; band < bands; band++ {
+		buckets := make(map[uint64][]int)
+		for i, signature := range signatures {
+			if signature == nil {
+				continue // Empty tests have nothing to compare
+			}
+			key := uint64(14695981039346656037)
+			for _, value := range signature[band*rows : (band+1)*rows] {
+				key = mix64(key ^ value)
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, bucket := range buckets {
+			for x := 0; x < len(bucket); x++ {
+				for y := x + 1; y < len(bucket); y++ {
+					pair := [2]int{bucket[x], bucket[y]}
+					if !seen[pair] {
+						seen[pair] = true
+						pairs = append(pairs, pair)
+					}
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(pairs, func(a, b [2]int) int {
+		if a[0] != b[0] {
+			return a[0] - b[0]
+		}
+		return a[1] - b[1]
+	})
+	return pairs
+}
+
+// Every pair (i < j) of n tests
+func allPairs(n int) iter.Seq2[int, int] {
+	return func(yield func(int, int) bool) {
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				if !yield(i, j) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func pairsOf(pairs [][2]int) iter.Seq2[int, int] {
+	return func(yield func(int, int) bool) {
+		for _, pair := range pairs {
+			if !yield(pair[0], pair[1]) {
+				return
+			}
+		}
+	}
+}
+
+// Choose the pairs of tests to compare; the summary is nil when every pair is compared
+func candidatePairs(corpus [][]string, opts CandidateOptions) (iter.Seq2[int, int], *CandidateSummary) {
+	if opts.Method != "lsh" {
+		return allPairs(len(corpus)), nil
+	}
+
+	pairs := LSHCandidates(corpus, opts.Bands, opts.Rows)
+	return pairsOf(pairs), lshSummary(opts, len(pairs), len(corpus)*(len(corpus)-1)/2)
+}
+
+// Every pair of a test before split with a test from split on
+func crossPairs(split, n int) iter.Seq2[int, int] {
+	return func(yield func(int, int) bool) {
+		for i := 0; i < split; i++ {
+			for j := split; j < n; j++ {
+				if !yield(i, j) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Choose the pairs across two suites, the tests before split against the tests from split on
+func crossCandidatePairs(corpus [][]string, split int, opts CandidateOptions) (iter.Seq2[int, int], *CandidateSummary) {
+	if opts.Method != "lsh" {
+		return crossPairs(split, len(corpus)), nil
+	}
+
+	var pairs [][2]int
+	for _, pair := range LSHCandidates(corpus, opts.Bands, opts.Rows) {
+		if pair[0] < split && pair[1] >= split {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairsOf(pairs), lshSummary(opts, len(pairs), split*(len(corpus)-split))
+}
+
+func lshSummary(opts CandidateOptions, candidates, total int) *CandidateSummary {
+	return &CandidateSummary{
+		Method:             opts.Method,
+		Threshold:          opts.Threshold,
+		Bands:              opts.Bands,
+		Rows:               opts.Rows,
+		Hashes:             opts.Bands * opts.Rows,
+		EffectiveThreshold: effectiveThreshold(opts.Bands, opts.Rows),
+		RecallAtThreshold:  candidateProbability(opts.Threshold, opts.Bands, opts.Rows),
+		CandidatePairs:     candidates,
+		TotalPairs:         total,
+	}
+}
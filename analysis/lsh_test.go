@@ -0,0 +1,111 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestMinHashSignature(t *testing.T) {
+	// 60 shared steps out of 100 distinct ones
+	var a, b []string
+	for i := 0; i < 80; i++ {
+		a = append(a, fmt.Sprintf("step %d", i))
+		b = append(b, fmt.Sprintf("step %d", i+20))
+	}
+	signatureA, signatureB := MinHashSignature(a, 256), MinHashSignature(b, 256)
+
+	agree := 0
+	for i := range signatureA {
+		if signatureA[i] == signatureB[i] {
+			agree++
+		}
+	}
+	if estimate := float64(agree) / 256; math.Abs(estimate-0.6) > 0.1 {
+		t.Errorf("Expected a Jaccard estimate near 0.6, got %f", estimate)
+	}
+	if MinHashSignature(nil, 8) != nil {
+		t.Errorf("Expected no signature for an empty test")
+	}
+}
+
+func TestLSHCandidates(t *testing.T) {
+	corpus := [][]string{
+		{"I am on the login page", "I log in as admin", "I see the dashboard"},
+		{"I search for shoes", "I see the results", "I add shoes to the basket"},
+		{"I am on the login page", "I log in as admin", "I see the dashboard"},
+		{},
+		{"I open the settings", "I change my password", "I log out"},
+	}
+
+	pairs := LSHCandidates(corpus, 32, 4)
+	if len(pairs) != 1 || pairs[0] != [2]int{0, 2} {
+		t.Errorf("Expected only the duplicate pair, got %v", pairs)
+	}
+}
+
+func TestBandsForThreshold(t *testing.T) {
+	for _, threshold := range []float64{0.3, 0.5, 0.8} {
+		bands, rows := bandsForThreshold(threshold, DefaultLSHHashes)
+		if bands*rows > DefaultLSHHashes {
+			t.Errorf("Expected at most %d hashes, got %d bands of %d rows", DefaultLSHHashes, bands, rows)
+		}
+		if effective := effectiveThreshold(bands, rows); math.Abs(effective-threshold) > 0.1 {
+			t.Errorf("Expected an effective threshold near %f, got %f", threshold, effective)
+		}
+	}
+}
+
+func TestGetSimilarityReportsLSH(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{
+		"login.feature":  loginFeature,
+		"copy.feature":   loginFeature,
+		"search.feature": searchFeature,
+	})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "candidates": {"lsh"}, "lsh_threshold": {"0.8"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports    map[string]SimilarityReport `json:"reports"`
+		Candidates CandidateSummary            `json:"candidates"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// Only the copied feature is a candidate, so the exact metrics run once
+	comparisons := res.Reports["lcs"].Comparisons
+	if len(comparisons) != 1 || comparisons[0].TestA != "copy.feature" || comparisons[0].TestB != "login.feature" {
+		t.Errorf("Unexpected comparisons: %+v", comparisons)
+	}
+	summary := res.Candidates
+	if summary.Method != "lsh" || summary.CandidatePairs != 1 || summary.TotalPairs != 3 || summary.Bands*summary.Rows != summary.Hashes {
+		t.Errorf("Unexpected candidate summary: %+v", summary)
+	}
+	if summary.RecallAtThreshold <= 0 || summary.RecallAtThreshold >= 1 {
+		t.Errorf("Expected a recall between 0 and 1, got %f", summary.RecallAtThreshold)
+	}
+}
+
+func TestGetSimilarityReportsInvalidCandidates(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	for _, query := range []url.Values{
+		{"candidates": {"random"}},
+		{"candidates": {"lsh"}, "lsh_threshold": {"0"}},
+		{"candidates": {"lsh"}, "lsh_bands": {"-2"}},
+		{"candidates": {"lsh"}, "lsh_bands": {"100000"}, "lsh_rows": {"100000"}},
+		{"candidates": {"lsh"}, "lsh_bands": {"64"}, "lsh_rows": {"32"}},
+	} {
+		query.Set("directory", dir)
+		if rr := getSimilarityReports(t, query); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code 400 for %v, got %d", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-similarity-reports/parsing"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// SimilarityMetric scores how alike two step sequences are, from 0 (nothing shared) to 1 (identical)
+type SimilarityMetric interface {
+	Name() string  // Key used by the metrics= parameter and in the response
+	Label() string // Human readable name reported as similarity_type
+	Similarity(a, b []string) float64
+}
+
+// DetailedMetric is a metric that can explain its score, e.g. with the alignment behind it.
+// The details are returned with every comparison of the raw steps.
+type DetailedMetric interface {
+	SimilarityMetric
+	SimilarityDetails(a, b []string) (float64, any)
+}
+
+// ConfigurableMetric is a metric with settings that can be changed per request.
+// Configure returns a copy configured from the query, leaving the registered metric untouched.
+type ConfigurableMetric interface {
+	SimilarityMetric
+	Configure(query url.Values) (SimilarityMetric, error)
+}
+
+// CorpusMetric is a metric that weighs steps by statistics of the whole suite, e.g. how many tests use them.
+// Fit returns a copy trained on the step sequences of every test in the request.
+type CorpusMetric interface {
+	SimilarityMetric
+	Fit(corpus [][]string) SimilarityMetric
+}
+
+// Explainer is a metric that can break its score down into the terms it is computed from, e.g. intersection and union sizes.
+// Explanations are only computed for a single pair by the explain endpoint.
+type Explainer interface {
+	SimilarityMetric
+	Explain(a, b []string) any
+}
+
+// metricFunc adapts a plain function to the SimilarityMetric interface
+type metricFunc struct {
+	name       string
+	label      string
+	similarity func(a, b []string) float64
+}
+
+func (m metricFunc) Name() string                     { return m.name }
+func (m metricFunc) Label() string                    { return m.label }
+func (m metricFunc) Similarity(a, b []string) float64 { return m.similarity(a, b) }
+
+// NewMetric wraps a similarity function as a SimilarityMetric
+func NewMetric(name, label string, similarity func(a, b []string) float64) SimilarityMetric {
+	return metricFunc{name: name, label: label, similarity: similarity}
+}
+
+// explainedMetric is a metricFunc with an explanation of its score
+type explainedMetric struct {
+	metricFunc
+	explain func(a, b []string) any
+}
+
+func (m explainedMetric) Explain(a, b []string) any { return m.explain(a, b) }
+
+// NewExplainedMetric wraps a similarity function and the function explaining its score as an Explainer
+func NewExplainedMetric(name, label string, similarity func(a, b []string) float64, explain func(a, b []string) any) SimilarityMetric {
+	return explainedMetric{metricFunc: metricFunc{name: name, label: label, similarity: similarity}, explain: explain}
+}
+
+// DefaultMetrics run when a request does not pass metrics=
+var DefaultMetrics = []string{"lcs", "cosine", "jaccard"}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]SimilarityMetric{}
+	registered []string // Registration order, used when listing metrics
+)
+
+func init() {
+	RegisterMetric(NewExplainedMetric("lcs", "LCS", LCSSimilarity, ExplainLCS))
+	RegisterMetric(NewExplainedMetric("cosine", "Cosine Similarity", CosineSimilarity, ExplainCosine))
+	RegisterMetric(NewExplainedMetric("jaccard", "Jaccard Index", JaccardIndex, ExplainSetOverlap))
+	RegisterMetric(EditDistanceMetric{Costs: DefaultEditCosts})
+	RegisterMetric(NewFuzzyMetric("soft_cosine", "Soft Cosine Similarity", SoftCosineSimilarity))
+	RegisterMetric(NewFuzzyMetric("fuzzy_jaccard", "Fuzzy Jaccard Index", FuzzyJaccardIndex))
+	RegisterMetric(NewFuzzyMetric("fuzzy_lcs", "Fuzzy LCS", FuzzyLCSSimilarity))
+	RegisterMetric(NewWeightedMetric("tfidf_cosine", "TF-IDF Cosine Similarity", WeightedCosineSimilarity))
+	RegisterMetric(NewWeightedMetric("weighted_jaccard", "Weighted Jaccard Index", WeightedJaccardIndex))
+	RegisterMetric(LSAMetric{Dims: DefaultLSADims})
+	RegisterMetric(LocalAlignmentMetric{Scoring: DefaultAlignmentScoring})
+	RegisterMetric(NewContainmentMetric("subsequence_containment", "Subsequence Containment", SubsequenceContainment))
+	RegisterMetric(NewContainmentMetric("set_containment", "Set Containment", SetContainment))
+	RegisterMetric(NewExplainedMetric("overlap_coefficient", "Overlap Coefficient", OverlapCoefficient, ExplainSetOverlap))
+}
+
+// RegisterMetric makes a metric available to the similarity endpoints.
+// It panics if a metric with the same name is already registered.
+func RegisterMetric(metric SimilarityMetric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, found := registry[metric.Name()]; found {
+		panic("analysis: metric " + metric.Name() + " registered twice")
+	}
+	registry[metric.Name()] = metric
+	registered = append(registered, metric.Name())
+}
+
+// LookupMetric returns the registered metric with the given name
+func LookupMetric(name string) (SimilarityMetric, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	metric, found := registry[name]
+	return metric, found
+}
+
+// Metrics returns every registered metric in registration order
+func Metrics() []SimilarityMetric {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	metrics := make([]SimilarityMetric, 0, len(registered))
+	for _, name := range registered {
+		metrics = append(metrics, registry[name])
+	}
+	return metrics
+}
+
+// Resolve the metrics= parameter (comma separated or repeated) into registered metrics
+func metricsFromQuery(query url.Values) ([]SimilarityMetric, error) {
+	var names []string
+	for _, value := range query["metrics"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		names = DefaultMetrics
+	}
+
+	var metrics []SimilarityMetric
+	var err error
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		metric, found := LookupMetric(name)
+		if !found {
+			return nil, fmt.Errorf("unknown metric %q", name)
+		}
+		if configurable, ok := metric.(ConfigurableMetric); ok {
+			if metric, err = configurable.Configure(query); err != nil {
+				return nil, err
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+// Train the corpus metrics on the steps of the tests being compared.
+// When the tests were normalised or bound to step definitions, each of those is trained on separately.
+func fitMetrics(metrics []SimilarityMetric, tests []parsing.Test) []SimilarityMetric {
+	var corpus, templates, definitions [][]string
+	fitted := make([]SimilarityMetric, len(metrics))
+	for i, metric := range metrics {
+		fitted[i] = metric
+		if corpusMetric, ok := metric.(CorpusMetric); ok {
+			if corpus == nil {
+				corpus = testSteps(tests)
+				templates = representationCorpus(tests, func(test parsing.Test) []string { return test.Templates })
+				definitions = representationCorpus(tests, func(test parsing.Test) []string { return test.Definitions })
+			}
+			result := fittedMetric{SimilarityMetric: corpusMetric.Fit(corpus)}
+			result.templates, result.definitions = result.SimilarityMetric, result.SimilarityMetric
+			if templates != nil {
+				result.templates = corpusMetric.Fit(templates)
+			}
+			if definitions != nil {
+				result.definitions = corpusMetric.Fit(definitions)
+			}
+			fitted[i] = result
+		}
+	}
+	return fitted
+}
+
+// fittedMetric is a corpus metric trained on each representation of the tests, so templates and step definitions
+// are weighed by how common they are rather than by the statistics of the raw steps
+type fittedMetric struct {
+	SimilarityMetric // Trained on the raw steps
+	templates        SimilarityMetric
+	definitions      SimilarityMetric
+}
+
+// Versions of a metric for the raw steps, the templates and the step definitions of the tests
+func representations(metric SimilarityMetric) (steps, templates, definitions SimilarityMetric) {
+	if fitted, ok := metric.(fittedMetric); ok {
+		return fitted.SimilarityMetric, fitted.templates, fitted.definitions
+	}
+	return metric, metric, metric
+}
+
+// One representation of every test that has it, or nil when none does
+func representationCorpus(tests []parsing.Test, representation func(parsing.Test) []string) [][]string {
+	var corpus [][]string
+	for _, test := range tests {
+		if steps := representation(test); steps != nil {
+			corpus = append(corpus, steps)
+		}
+	}
+	return corpus
+}
+
+func testSteps(tests []parsing.Test) [][]string {
+	corpus := make([][]string, len(tests))
+	for i, test := range tests {
+		corpus[i] = test.Steps
+	}
+	return corpus
+}
+
+// Steps of each test with the templates in place of the raw steps when normalize= is set
+func normalizedSteps(tests []parsing.Test) [][]string {
+	corpus := testSteps(tests)
+	for i, test := range tests {
+		if test.Templates != nil {
+			corpus[i] = test.Templates
+		}
+	}
+	return corpus
+}
+
+// Endpoint to list the registered similarity metrics
+func GetSimilarityMetrics(w http.ResponseWriter, r *http.Request) {
+	type metricInfo struct {
+		Name    string `json:"name"`
+		Label   string `json:"label"`
+		Default bool   `json:"default"`
+	}
+
+	defaults := make(map[string]bool)
+	for _, name := range DefaultMetrics {
+		defaults[name] = true
+	}
+	response := []metricInfo{}
+	for _, metric := range Metrics() {
+		response = append(response, metricInfo{Name: metric.Name(), Label: metric.Label(), Default: defaults[metric.Name()]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRegisterMetric(t *testing.T) {
+	// Counts the steps both tests share by position
+	RegisterMetric(NewMetric("test_prefix", "Shared Prefix", func(a, b []string) float64 {
+		shared := 0
+		for shared < len(a) && shared < len(b) && a[shared] == b[shared] {
+			shared++
+		}
+		return float64(shared)
+	}))
+
+	metric, found := LookupMetric("test_prefix")
+	if !found {
+		t.Fatalf("Expected test_prefix to be registered")
+	}
+	if result := metric.Similarity([]string{"A", "B", "C"}, []string{"A", "B", "D"}); result != 2 {
+		t.Errorf("Expected 2, got %f", result)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected registering a duplicate metric to panic")
+		}
+	}()
+	RegisterMetric(NewMetric("lcs", "LCS", LCSSimilarity))
+}
+
+func TestGetSimilarityReportsMetrics(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature, "search.feature": searchFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "metrics": {"jaccard,cosine"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports map[string]SimilarityReport `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// Only the requested metrics are computed
+	if len(res.Reports) != 2 {
+		t.Errorf("Expected 2 reports, got %d", len(res.Reports))
+	}
+	if res.Reports["jaccard"].SimilarityType != "Jaccard Index" || res.Reports["cosine"].SimilarityType != "Cosine Similarity" {
+		t.Errorf("Unexpected reports: %+v", res.Reports)
+	}
+	if _, found := res.Reports["lcs"]; found {
+		t.Errorf("Expected no lcs report")
+	}
+}
+
+func TestGetSimilarityReportsUnknownMetric(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "metrics": {"lcs,levenshtein"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got %d", rr.Code)
+	}
+}
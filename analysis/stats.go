@@ -3,6 +3,8 @@ package analysis
 import (
 	"encoding/json"
 	"go-similarity-reports/parsing"
+	"go-similarity-reports/stepdefs"
+	"iter"
 	"math"
 	"net/http"
 )
@@ -10,12 +12,44 @@ import (
 type SimilarityReport struct {
 	SimilarityType string            `json:"similarity_type"`
 	Comparisons    []ComparisonEntry `json:"comparisons"`
+	BestMatches    []BestMatch       `json:"best_matches,omitempty"` // Suite B tests with their closest suite A test, in cross-suite mode
+	Coverage       *CoverageSummary  `json:"coverage,omitempty"`     // How much of suite B exists in suite A, in cross-suite mode
 }
 
 type ComparisonEntry struct {
-	TestA      string  `json:"test_a"`
-	TestB      string  `json:"test_b"`
-	Similarity float64 `json:"similarity"`
+	TestA                string          `json:"test_a"`
+	TestB                string          `json:"test_b"`
+	RefA                 parsing.TestRef `json:"ref_a"`
+	RefB                 parsing.TestRef `json:"ref_b"`
+	Similarity           float64         `json:"similarity"`
+	TemplateSimilarity   *float64        `json:"template_similarity,omitempty"`   // Score over normalised steps, when requested
+	DefinitionSimilarity *float64        `json:"definition_similarity,omitempty"` // Score over bound step definitions, when requested
+	Details              any             `json:"details,omitempty"`               // Explanation of the score, for metrics that provide one
+}
+
+// Compare two tests with a metric, adding the template score when the tests were normalised
+func compareTests(a, b parsing.Test, metric SimilarityMetric) ComparisonEntry {
+	metric, templates, definitions := representations(metric)
+	entry := ComparisonEntry{
+		TestA: a.Name,
+		TestB: b.Name,
+		RefA:  a.Ref,
+		RefB:  b.Ref,
+	}
+	if detailed, ok := metric.(DetailedMetric); ok {
+		entry.Similarity, entry.Details = detailed.SimilarityDetails(a.Steps, b.Steps)
+	} else {
+		entry.Similarity = metric.Similarity(a.Steps, b.Steps)
+	}
+	if a.Templates != nil && b.Templates != nil {
+		templateSimilarity := templates.Similarity(a.Templates, b.Templates)
+		entry.TemplateSimilarity = &templateSimilarity
+	}
+	if a.Definitions != nil && b.Definitions != nil {
+		definitionSimilarity := definitions.Similarity(a.Definitions, b.Definitions)
+		entry.DefinitionSimilarity = &definitionSimilarity
+	}
+	return entry
 }
 
 // Calculate Longest Common Subsequence (LCS)
@@ -38,6 +72,16 @@ func LCS(X, Y []string) int {
 	return dp[m][n]
 }
 
+// Normalise the LCS length by the size of both sequences
+func LCSSimilarity(testA, testB []string) float64 {
+	lcs := LCS(testA, testB)
+	total := len(testA) + len(testB) - lcs
+	if total == 0 {
+		return 0.0 // Two empty tests have nothing to compare
+	}
+	return float64(lcs) / float64(total)
+}
+
 func CosineSimilarity(testA, testB []string) float64 {
 	// Create frequency maps for steps in both tests
 	stepCountA := make(map[string]int)
@@ -103,6 +147,9 @@ func JaccardIndex(setA, setB []string) float64 {
 	}
 
 	unionSize := len(setASet) + len(setBSet) - intersectionSize
+	if unionSize == 0 {
+		return 0.0 // Two empty tests have nothing to compare
+	}
 	return float64(intersectionSize) / float64(unionSize)
 }
 
@@ -113,61 +160,157 @@ func max(a, b int) int {
 	return b
 }
 
-// Endpoint to get similarity reports
-func GetSimilarityReports(w http.ResponseWriter, r *http.Request) {
+// Parse the directory of a request into tests, applying the test and walk options from its query.
+// Errors are written to w, in which case ok is false.
+func loadTests(w http.ResponseWriter, r *http.Request) (tests []parsing.Test, diagnostics []parsing.Diagnostic, ok bool) {
 	dir := r.URL.Query().Get("directory")
 	if dir == "" {
 		dir = "./tdata" // Default path
 	}
 
-	tests, err := parsing.ParseFeatureFiles(dir)
+	suites, diagnostics, ok := loadSuites(w, r, dir)
+	if !ok {
+		return nil, nil, false
+	}
+	return suites[0], diagnostics, true
+}
+
+// Parse each directory into its own suite of tests, with the options from the query applied to all of them.
+// Errors are written to w, in which case ok is false.
+func loadSuites(w http.ResponseWriter, r *http.Request, dirs ...string) (suites [][]parsing.Test, diagnostics []parsing.Diagnostic, ok bool) {
+	query := r.URL.Query()
+	testOpts, err := parsing.TestOptionsFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	diagnostics = []parsing.Diagnostic{}
+	for _, dir := range dirs {
+		features, featureDiagnostics, err := parsing.ParseFeatures(dir, parsing.WalkOptionsFromQuery(query))
+		if err != nil {
+			http.Error(w, "Error parsing tests: "+err.Error(), http.StatusInternalServerError)
+			return nil, nil, false
+		}
+		suites = append(suites, parsing.BuildTests(features, testOpts))
+		diagnostics = append(diagnostics, featureDiagnostics...)
+	}
+
+	// Bind steps to godog step definitions so differently worded steps for the same code compare equal
+	if source := query.Get("step_definitions"); source != "" {
+		defs, defDiagnostics, err := stepdefs.ScanDefinitions(source)
+		if err != nil {
+			http.Error(w, "Error scanning step definitions: "+err.Error(), http.StatusInternalServerError)
+			return nil, nil, false
+		}
+		for _, tests := range suites {
+			defs.Bind(tests)
+		}
+		diagnostics = append(diagnostics, defDiagnostics...)
+	}
+	return suites, diagnostics, true
+}
+
+// Endpoint to get similarity reports
+func GetSimilarityReports(w http.ResponseWriter, r *http.Request) {
+	metrics, err := metricsFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	candidateOpts, err := candidatesFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	workers, err := workersFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filterOpts, err := filterFromQuery(r.URL.Query())
 	if err != nil {
-		http.Error(w, "Error parsing tests: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	crossOpts, err := crossSuiteFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// top_k and metric_sort need every comparison before the first can be written
+	streaming := wantsNDJSON(r)
+	if streaming && (filterOpts.TopK > 0 || filterOpts.Sort != "") {
+		http.Error(w, "top_k and metric_sort are not supported when streaming "+NDJSONContentType, http.StatusBadRequest)
+		return
+	}
+	// Best matches are only known once every pair has been compared
+	if streaming && crossOpts != nil {
+		http.Error(w, "directory_a and directory_b are not supported when streaming "+NDJSONContentType, http.StatusBadRequest)
 		return
 	}
 
-	lcsReport := SimilarityReport{SimilarityType: "LCS", Comparisons: []ComparisonEntry{}}
-	cosineReport := SimilarityReport{SimilarityType: "Cosine Similarity", Comparisons: []ComparisonEntry{}}
-	jaccardReport := SimilarityReport{SimilarityType: "Jaccard Index", Comparisons: []ComparisonEntry{}}
-
-	for i := 0; i < len(tests); i++ {
-		for j := i + 1; j < len(tests); j++ {
-			// Calculate LCS
-			lcs := LCS(tests[i].Steps, tests[j].Steps)
-			lcsSimilarity := float64(lcs) / float64(len(tests[i].Steps)+len(tests[j].Steps)-lcs)
-			lcsReport.Comparisons = append(lcsReport.Comparisons, ComparisonEntry{
-				TestA:      tests[i].Name,
-				TestB:      tests[j].Name,
-				Similarity: lcsSimilarity,
-			})
-
-			// Calculate Cosine Similarity
-			cosineSimilarity := CosineSimilarity(tests[i].Steps, tests[j].Steps)
-			cosineReport.Comparisons = append(cosineReport.Comparisons, ComparisonEntry{
-				TestA:      tests[i].Name,
-				TestB:      tests[j].Name,
-				Similarity: cosineSimilarity,
-			})
-
-			// Calculate Jaccard Index
-			jaccardSimilarity := JaccardIndex(tests[i].Steps, tests[j].Steps)
-			jaccardReport.Comparisons = append(jaccardReport.Comparisons, ComparisonEntry{
-				TestA:      tests[i].Name,
-				TestB:      tests[j].Name,
-				Similarity: jaccardSimilarity,
-			})
+	// In cross-suite mode both suites are compared as one list, suite A first, but only across the split
+	tests, split, diagnostics, ok := loadComparedTests(w, r, crossOpts)
+	if !ok {
+		return
+	}
+	metrics = fitMetrics(metrics, tests)
+
+	// With LSH only the candidate pairs go through the exact metrics
+	var pairs iter.Seq2[int, int]
+	var candidates *CandidateSummary
+	if crossOpts != nil {
+		pairs, candidates = crossCandidatePairs(testSteps(tests), split, candidateOpts)
+	} else {
+		pairs, candidates = candidatePairs(testSteps(tests), candidateOpts)
+	}
+	if streaming {
+		streamComparisons(w, r, tests, pairs, metrics, workers, filterOpts, candidates, diagnostics)
+		return
+	}
+
+	// Every selected metric gets its own report, keyed by metric name, filtered as the pairs are compared
+	reports := make(map[string]SimilarityReport, len(metrics))
+	filters := make([]*comparisonFilter, len(metrics))
+	matches := make([]*bestMatches, len(metrics))
+	for k := range metrics {
+		filters[k] = newComparisonFilter(filterOpts, len(tests))
+		if crossOpts != nil {
+			matches[k] = newBestMatches(tests, split)
+		}
+	}
+	err = comparePairs(r.Context(), tests, pairs, metrics, workers, func(i, j int, entries []ComparisonEntry) error {
+		for k, entry := range entries {
+			filters[k].Add(i, j, entry)
+			if matches[k] != nil {
+				matches[k].Add(i, j, entry.Similarity)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// The client went away or the deadline passed, so the reports are incomplete
+		http.Error(w, "Similarity computation cancelled: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	for k, metric := range metrics {
+		report := SimilarityReport{SimilarityType: metric.Label(), Comparisons: filters[k].Results()}
+		if matches[k] != nil {
+			report.BestMatches, report.Coverage = matches[k].Results(crossOpts.MatchThreshold)
 		}
+		reports[metric.Name()] = report
 	}
 
 	// Prepare the response
 	response := struct {
-		LCSReport     SimilarityReport `json:"lcs_report"`
-		CosineReport  SimilarityReport `json:"cosine_report"`
-		JaccardReport SimilarityReport `json:"jaccard_report"`
+		Reports     map[string]SimilarityReport `json:"reports"`
+		Candidates  *CandidateSummary           `json:"candidates,omitempty"`
+		Diagnostics []parsing.Diagnostic        `json:"diagnostics"`
 	}{
-		LCSReport:     lcsReport,
-		CosineReport:  cosineReport,
-		JaccardReport: jaccardReport,
+		Reports:     reports,
+		Candidates:  candidates,
+		Diagnostics: diagnostics,
 	}
 
 	// Set header and return JSON response
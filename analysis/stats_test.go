@@ -0,0 +1,168 @@
+package analysis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const loginFeature = `Feature: Login
+  Scenario: Admin logs in
+    Given I am on the login page
+    When I log in as "admin"
+    Then I see the dashboard
+
+  Scenario: Guest logs in
+    Given I am on the login page
+    When I log in as "guest"
+    Then I see the dashboard
+`
+
+const searchFeature = `Feature: Search
+  Scenario: Search for a product
+    Given I am on the login page
+    When I search for "shoes"
+    Then I see the results
+`
+
+// Helper function to create a directory of feature files for handler tests
+func writeFeatureDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Error writing feature file: %v", err)
+		}
+	}
+	return dir
+}
+
+// Helper function to call GetSimilarityReports with the given query
+func getSimilarityReports(t *testing.T, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/similarity-reports?"+query.Encode(), nil)
+	rr := httptest.NewRecorder()
+	GetSimilarityReports(rr, req)
+	return rr
+}
+
+func TestLCS(t *testing.T) {
+	tests := []struct {
+		a, b     []string
+		expected int
+	}{
+		{[]string{"A", "B", "C"}, []string{"B", "C", "D"}, 2},
+		{[]string{"A", "B"}, []string{"C"}, 0},
+		{nil, []string{"A"}, 0},
+	}
+
+	for _, test := range tests {
+		if result := LCS(test.a, test.b); result != test.expected {
+			t.Errorf("Expected %d, got %d", test.expected, result)
+		}
+	}
+}
+
+func TestGetSimilarityReportsScenarioGranularity(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature, "search.feature": searchFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"scenario"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports map[string]SimilarityReport `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// Three scenarios give three pairs
+	lcsReport := res.Reports["lcs"]
+	if len(lcsReport.Comparisons) != 3 {
+		t.Fatalf("Expected 3 comparisons, got %d", len(lcsReport.Comparisons))
+	}
+	first := lcsReport.Comparisons[0]
+	if first.RefA.File != "login.feature" || first.RefA.Scenario != "Admin logs in" || first.RefA.Line != 2 {
+		t.Errorf("Unexpected reference for test A: %+v", first.RefA)
+	}
+	if first.RefB.Scenario != "Guest logs in" || first.RefB.Line != 7 {
+		t.Errorf("Unexpected reference for test B: %+v", first.RefB)
+	}
+}
+
+func TestGetSimilarityReportsInvalidGranularity(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"step"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got %d", rr.Code)
+	}
+}
+
+func TestGetSimilarityReportsDiagnostics(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{
+		"login.feature":  loginFeature,
+		"search.feature": searchFeature,
+		"broken.feature": "Feature: Broken\n  Scenario: Fails\n    Given something\n  Nonsense line\n",
+	})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports     map[string]SimilarityReport `json:"reports"`
+		Diagnostics []struct {
+			File     string `json:"file"`
+			Line     int    `json:"line"`
+			Severity string `json:"severity"`
+		} `json:"diagnostics"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// The broken file is reported but the remaining files are still compared
+	if len(res.Reports["lcs"].Comparisons) != 1 {
+		t.Errorf("Expected 1 comparison, got %d", len(res.Reports["lcs"].Comparisons))
+	}
+	if len(res.Diagnostics) != 1 || res.Diagnostics[0].File != "broken.feature" || res.Diagnostics[0].Line != 4 {
+		t.Errorf("Unexpected diagnostics: %+v", res.Diagnostics)
+	}
+}
+
+func TestGetSimilarityReportsTemplateSimilarity(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	rr := getSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"scenario"}, "normalize": {"strings"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Reports map[string]SimilarityReport `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// The scenarios differ only in a quoted value
+	entry := res.Reports["jaccard"].Comparisons[0]
+	if entry.Similarity != 0.5 {
+		t.Errorf("Expected raw similarity 0.5, got %f", entry.Similarity)
+	}
+	if entry.TemplateSimilarity == nil || *entry.TemplateSimilarity != 1 {
+		t.Errorf("Expected template similarity 1, got %v", entry.TemplateSimilarity)
+	}
+}
@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"encoding/json"
+	"go-similarity-reports/parsing"
+	"iter"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NDJSONContentType is requested through the Accept header to stream comparisons one per line
+const NDJSONContentType = "application/x-ndjson"
+
+// Flush the stream after this many lines or this much time, whichever comes first
+const (
+	streamFlushLines    = 100
+	streamFlushInterval = 250 * time.Millisecond
+)
+
+// StreamLine is one line of an NDJSON similarity stream. Type says which fields are set:
+// "metric" announces a report, "diagnostic" and "candidates" describe the run,
+// "comparison" carries one entry of a report, and "done" or "error" ends the stream.
+type StreamLine struct {
+	Type        string              `json:"type"`
+	Metric      string              `json:"metric,omitempty"`
+	Label       string              `json:"label,omitempty"`
+	Comparison  *ComparisonEntry    `json:"comparison,omitempty"`
+	Diagnostic  *parsing.Diagnostic `json:"diagnostic,omitempty"`
+	Candidates  *CandidateSummary   `json:"candidates,omitempty"`
+	Comparisons int                 `json:"comparisons,omitempty"` // Number of comparison lines, on the done line
+	Error       string              `json:"error,omitempty"`
+}
+
+// Whether the client asked for NDJSON
+func wantsNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), NDJSONContentType)
+}
+
+// Stream every comparison as soon as it is computed, so memory stays flat however many pairs there are.
+// Comparisons below filterOpts.MinSimilarity are skipped.
+func streamComparisons(w http.ResponseWriter, r *http.Request, tests []parsing.Test, pairs iter.Seq2[int, int], metrics []SimilarityMetric, workers int, filterOpts FilterOptions, candidates *CandidateSummary, diagnostics []parsing.Diagnostic) {
+	w.Header().Set("Content-Type", NDJSONContentType)
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	unflushed, lastFlush := 0, time.Now()
+	write := func(line StreamLine) error {
+		if err := encoder.Encode(line); err != nil {
+			return err // The client went away
+		}
+		unflushed++
+		if flusher != nil && (unflushed >= streamFlushLines || time.Since(lastFlush) >= streamFlushInterval) {
+			flusher.Flush()
+			unflushed, lastFlush = 0, time.Now()
+		}
+		return nil
+	}
+
+	for _, metric := range metrics {
+		write(StreamLine{Type: "metric", Metric: metric.Name(), Label: metric.Label()})
+	}
+	for i := range diagnostics {
+		write(StreamLine{Type: "diagnostic", Diagnostic: &diagnostics[i]})
+	}
+	if candidates != nil {
+		write(StreamLine{Type: "candidates", Candidates: candidates})
+	}
+
+	count := 0
+	err := comparePairs(r.Context(), tests, pairs, metrics, workers, func(i, j int, entries []ComparisonEntry) error {
+		for k := range entries {
+			if entries[k].Similarity < filterOpts.MinSimilarity {
+				continue
+			}
+			if err := write(StreamLine{Type: "comparison", Metric: metrics[k].Name(), Comparison: &entries[k]}); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+
+	// Headers are already sent, so a failure ends the stream with an error line instead of a status code
+	if err != nil {
+		write(StreamLine{Type: "error", Error: "Similarity computation cancelled: " + err.Error()})
+	} else {
+		write(StreamLine{Type: "done", Comparisons: count})
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,86 @@
+package analysis
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// Helper function to call GetSimilarityReports asking for NDJSON
+func streamSimilarityReports(t *testing.T, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/similarity-reports?"+query.Encode(), nil)
+	req.Header.Set("Accept", NDJSONContentType)
+	rr := httptest.NewRecorder()
+	GetSimilarityReports(rr, req)
+	return rr
+}
+
+func TestGetSimilarityReportsNDJSON(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{
+		"login.feature":  loginFeature,
+		"search.feature": searchFeature,
+		"broken.feature": "Feature: Broken\n  Scenario: Fails\n    Given something\n  Nonsense line\n",
+	})
+
+	rr := streamSimilarityReports(t, url.Values{"directory": {dir}, "granularity": {"scenario"}, "metrics": {"lcs,jaccard"}, "min_similarity": {"0.3"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != NDJSONContentType {
+		t.Errorf("Expected content type %s, got %s", NDJSONContentType, contentType)
+	}
+	if !rr.Flushed {
+		t.Errorf("Expected the stream to be flushed")
+	}
+
+	// Every line is a JSON document on its own
+	var lines []StreamLine
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var line StreamLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Error decoding line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	var types []string
+	for _, line := range lines {
+		types = append(types, line.Type)
+	}
+	expected := []string{"metric", "metric", "diagnostic", "comparison", "comparison", "done"}
+	if len(types) != len(expected) {
+		t.Fatalf("Expected lines %v, got %v", expected, types)
+	}
+	for k := range expected {
+		if types[k] != expected[k] {
+			t.Fatalf("Expected lines %v, got %v", expected, types)
+		}
+	}
+
+	// Only the two login scenarios score above the threshold
+	if lines[0].Metric != "lcs" || lines[0].Label != "LCS" || lines[2].Diagnostic.File != "broken.feature" {
+		t.Errorf("Unexpected header lines: %+v", lines[:3])
+	}
+	if lines[3].Metric != "lcs" || lines[4].Metric != "jaccard" || lines[3].Comparison.RefB.Scenario != "Guest logs in" {
+		t.Errorf("Unexpected comparison lines: %+v %+v", lines[3], lines[4])
+	}
+	if lines[5].Comparisons != 2 {
+		t.Errorf("Expected 2 comparisons on the done line, got %d", lines[5].Comparisons)
+	}
+}
+
+func TestGetSimilarityReportsNDJSONUnsupportedFilters(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature})
+
+	for _, query := range []url.Values{{"top_k": {"3"}}, {"metric_sort": {"desc"}}} {
+		query.Set("directory", dir)
+		if rr := streamSimilarityReports(t, query); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code 400 for %v, got %d", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package analysis
+
+import (
+	"encoding/json"
+	"go-similarity-reports/parsing"
+	"math"
+	"net/http"
+	"sort"
+)
+
+// IDFTable records how many tests use each step, so steps shared by most of the suite weigh little
+type IDFTable struct {
+	Documents int
+	frequency map[string]int
+}
+
+// IDFEntry is the weight of one step in the IDF report
+type IDFEntry struct {
+	Step      string  `json:"step"`
+	Documents int     `json:"documents"` // Number of tests using the step
+	Share     float64 `json:"share"`     // Fraction of tests using the step
+	IDF       float64 `json:"idf"`
+}
+
+// NewIDFTable counts the tests each step appears in, once per test
+func NewIDFTable(corpus [][]string) *IDFTable {
+	table := &IDFTable{Documents: len(corpus), frequency: make(map[string]int)}
+	for _, steps := range corpus {
+		for step := range stepCounts(steps) {
+			table.frequency[step]++
+		}
+	}
+	return table
+}
+
+// IDF is the smoothed inverse document frequency ln((N+1)/(df+1)) + 1.
+// Steps used by every test weigh 1 and steps the corpus has never seen weigh the most; a nil table weighs every step 1.
+func (t *IDFTable) IDF(step string) float64 {
+	if t == nil {
+		return 1
+	}
+	return math.Log(float64(t.Documents+1)/float64(t.frequency[step]+1)) + 1
+}
+
+// Entries lists every step from the noisiest (lowest IDF) to the most distinctive
+func (t *IDFTable) Entries() []IDFEntry {
+	entries := make([]IDFEntry, 0, len(t.frequency))
+	for step, documents := range t.frequency {
+		entries = append(entries, IDFEntry{
+			Step:      step,
+			Documents: documents,
+			Share:     float64(documents) / float64(t.Documents),
+			IDF:       t.IDF(step),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IDF != entries[j].IDF {
+			return entries[i].IDF < entries[j].IDF
+		}
+		return entries[i].Step < entries[j].Step
+	})
+	return entries
+}
+
+// StepWeight gives the importance of a step when comparing tests
+type StepWeight func(step string) float64
+
+// WeightedCosineSimilarity is CosineSimilarity over step counts multiplied by their weight (TF-IDF with IDF weights)
+func WeightedCosineSimilarity(testA, testB []string, weight StepWeight) float64 {
+	countA, countB := stepCounts(testA), stepCounts(testB)
+
+	dotProduct, magA, magB := 0.0, 0.0, 0.0
+	for _, step := range sortedSteps(countA, countB) {
+		w := weight(step)
+		a, b := float64(countA[step])*w, float64(countB[step])*w
+		dotProduct += a * b
+		magA += a * a
+		magB += b * b
+	}
+
+	if magA == 0 || magB == 0 {
+		return 0.0 // If either test has no steps, similarity is undefined, return 0
+	}
+	return dotProduct / (math.Sqrt(magA) * math.Sqrt(magB))
+}
+
+// WeightedJaccardIndex is the Ruzicka similarity: the sum of the smaller weighted step counts over the sum of the larger ones
+func WeightedJaccardIndex(setA, setB []string, weight StepWeight) float64 {
+	countA, countB := stepCounts(setA), stepCounts(setB)
+
+	intersection, union := 0.0, 0.0
+	for _, step := range sortedSteps(countA, countB) {
+		w := weight(step)
+		a, b := float64(countA[step])*w, float64(countB[step])*w
+		intersection += math.Min(a, b)
+		union += math.Max(a, b)
+	}
+
+	if union == 0 {
+		return 0.0 // Two empty tests have nothing to compare
+	}
+	return intersection / union
+}
+
+// WeightedMetric is a metric that weighs steps by their IDF over the tests of the request
+type WeightedMetric struct {
+	name       string
+	label      string
+	IDF        *IDFTable // Nil until the metric is fitted, which weighs every step equally
+	similarity func(a, b []string, weight StepWeight) float64
+}
+
+// NewWeightedMetric wraps a weighted similarity function as a CorpusMetric
+func NewWeightedMetric(name, label string, similarity func(a, b []string, weight StepWeight) float64) WeightedMetric {
+	return WeightedMetric{name: name, label: label, similarity: similarity}
+}
+
+func (m WeightedMetric) Name() string  { return m.name }
+func (m WeightedMetric) Label() string { return m.label }
+
+func (m WeightedMetric) Similarity(a, b []string) float64 {
+	return m.similarity(a, b, m.IDF.IDF)
+}
+
+func (m WeightedMetric) Fit(corpus [][]string) SimilarityMetric {
+	m.IDF = NewIDFTable(corpus)
+	return m
+}
+
+// Endpoint to get the IDF of every step, from the noisiest to the most distinctive
+func GetIDFReport(w http.ResponseWriter, r *http.Request) {
+	tests, diagnostics, ok := loadTests(w, r)
+	if !ok {
+		return
+	}
+	table := NewIDFTable(testSteps(tests))
+
+	response := struct {
+		Documents   int                  `json:"documents"`
+		Steps       []IDFEntry           `json:"steps"`
+		Diagnostics []parsing.Diagnostic `json:"diagnostics"`
+	}{
+		Documents:   table.Documents,
+		Steps:       table.Entries(),
+		Diagnostics: diagnostics,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,120 @@
+package analysis
+
+import (
+	"encoding/json"
+	"go-similarity-reports/parsing"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestIDFTable(t *testing.T) {
+	table := NewIDFTable([][]string{
+		{"I am logged in", "I open the basket", "I am logged in"},
+		{"I am logged in", "I pay"},
+		{"I am logged in", "I pay"},
+	})
+
+	tests := []struct {
+		step     string
+		expected float64
+	}{
+		{"I am logged in", 1},                        // Used by every test
+		{"I pay", math.Log(4.0/3.0) + 1},             // Used by two tests
+		{"I open the basket", math.Log(4.0/2.0) + 1}, // Used by one test, counted once
+		{"I log out", math.Log(4.0/1.0) + 1},         // Never seen
+	}
+	for _, test := range tests {
+		if result := table.IDF(test.step); math.Abs(result-test.expected) > 1e-9 {
+			t.Errorf("Expected IDF %f for %q, got %f", test.expected, test.step, result)
+		}
+	}
+
+	entries := table.Entries()
+	if len(entries) != 3 || entries[0].Step != "I am logged in" || entries[0].Share != 1 || entries[2].Step != "I open the basket" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+	if (*IDFTable)(nil).IDF("I pay") != 1 {
+		t.Errorf("Expected a nil table to weigh every step 1")
+	}
+}
+
+func TestWeightedMetrics(t *testing.T) {
+	a := []string{"I am logged in", "I open the basket", "I remove an item"}
+	b := []string{"I am logged in", "I search for shoes", "I see the results"}
+	corpus := [][]string{a, b, {"I am logged in", "I pay"}, {"I am logged in", "I log out"}}
+
+	tests := []struct {
+		name     string
+		weighted func(a, b []string, weight StepWeight) float64
+		plain    func(a, b []string) float64
+	}{
+		{"tfidf_cosine", WeightedCosineSimilarity, CosineSimilarity},
+		{"weighted_jaccard", WeightedJaccardIndex, JaccardIndex},
+	}
+
+	for _, test := range tests {
+		metric := NewWeightedMetric(test.name, test.name, test.weighted)
+
+		// Unfitted metrics weigh every step equally
+		if weighted, plain := metric.Similarity(a, b), test.plain(a, b); math.Abs(weighted-plain) > 1e-9 {
+			t.Errorf("%s: expected %f before fitting, got %f", test.name, plain, weighted)
+		}
+		// The shared boilerplate step counts for less once the suite is known
+		fitted := metric.Fit(corpus)
+		if weighted, plain := fitted.Similarity(a, b), test.plain(a, b); weighted >= plain {
+			t.Errorf("%s: expected less than %f after fitting, got %f", test.name, plain, weighted)
+		}
+		if result := fitted.Similarity(a, a); math.Abs(result-1) > 1e-9 {
+			t.Errorf("%s: expected identical tests to score 1, got %f", test.name, result)
+		}
+	}
+}
+
+func TestFitMetricsRepresentations(t *testing.T) {
+	tests := []parsing.Test{
+		{Name: "A", Steps: []string{`I log in as "admin"`, "I open the basket"}, Templates: []string{"I log in as <string>", "I open the basket"}},
+		{Name: "B", Steps: []string{`I log in as "guest"`, "I pay"}, Templates: []string{"I log in as <string>", "I pay"}},
+		{Name: "C", Steps: []string{`I log in as "root"`, "I log out"}, Templates: []string{"I log in as <string>", "I log out"}},
+	}
+	metric := NewWeightedMetric("weighted_jaccard", "Weighted Jaccard Index", WeightedJaccardIndex)
+
+	// The login template is used by every test, so it weighs no more than any other template
+	entry := compareTests(tests[0], tests[1], fitMetrics([]SimilarityMetric{metric}, tests)[0])
+	expected := metric.Fit(normalizedSteps(tests)).Similarity(tests[0].Templates, tests[1].Templates)
+	if entry.TemplateSimilarity == nil || !closeTo(*entry.TemplateSimilarity, expected) {
+		t.Errorf("Expected template similarity %v, got %v", expected, entry.TemplateSimilarity)
+	}
+	if fittedOnSteps := metric.Fit(testSteps(tests)).Similarity(tests[0].Templates, tests[1].Templates); fittedOnSteps <= expected {
+		t.Errorf("Expected the raw step weights to overrate the shared template, got %v and %v", fittedOnSteps, expected)
+	}
+}
+
+func TestGetIDFReport(t *testing.T) {
+	dir := writeFeatureDir(t, map[string]string{"login.feature": loginFeature, "search.feature": searchFeature})
+
+	req := httptest.NewRequest("GET", "/api/similarity-reports/idf?"+url.Values{"directory": {dir}, "granularity": {"scenario"}}.Encode(), nil)
+	rr := httptest.NewRecorder()
+	GetIDFReport(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var res struct {
+		Documents int        `json:"documents"`
+		Steps     []IDFEntry `json:"steps"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// Every scenario starts on the login page, so that step is the noisiest
+	if res.Documents != 3 {
+		t.Errorf("Expected 3 documents, got %d", res.Documents)
+	}
+	if len(res.Steps) == 0 || res.Steps[0].Step != "I am on the login page" || res.Steps[0].Documents != 3 || res.Steps[0].IDF != 1 {
+		t.Errorf("Unexpected steps: %+v", res.Steps)
+	}
+}
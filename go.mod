@@ -2,13 +2,15 @@ module go-similarity-reports
 
 go 1.23.2
 
-require github.com/gorilla/mux v1.8.1
+require (
+	github.com/cucumber/messages/go/v22 v22.0.0
+	github.com/gorilla/mux v1.8.1
+	gonum.org/v1/gonum v0.7.0
+)
 
 require (
-	github.com/cucumber/messages/go/v22 v22.0.0 // indirect
 	github.com/deckarep/golang-set v1.7.1 // indirect
 	github.com/mingrammer/commonregex v1.0.1 // indirect
-	gonum.org/v1/gonum v0.7.0 // indirect
 	gopkg.in/neurosnap/sentences.v1 v1.0.6 // indirect
 )
 
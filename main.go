@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"go-similarity-reports/analysis"
 	"go-similarity-reports/optimize"
+	"go-similarity-reports/parsing"
+	"go-similarity-reports/stepdefs"
 	"go-similarity-reports/visualizations"
 	"net/http"
 	"os"
@@ -15,8 +17,16 @@ import (
 func main() {
 	router := mux.NewRouter()
 	router.HandleFunc("/api/similarity-reports", analysis.GetSimilarityReports).Methods("GET")
+	router.HandleFunc("/api/similarity-metrics", analysis.GetSimilarityMetrics).Methods("GET")
+	router.HandleFunc("/api/similarity-reports/idf", analysis.GetIDFReport).Methods("GET")
+	router.HandleFunc("/api/similarity-reports/clusters", analysis.GetSimilarityClusters).Methods("GET")
+	router.HandleFunc("/api/similarity-reports/blocks", analysis.GetRepeatedStepBlocks).Methods("GET")
+	router.HandleFunc("/api/similarity-reports/redundant", analysis.GetRedundantTests).Methods("GET")
+	router.HandleFunc("/api/similarity-reports/explain", analysis.GetSimilarityExplanation).Methods("GET")
 	router.HandleFunc("/api/test-journeys", visualizations.GetTestJourneys).Methods("GET")
 	router.HandleFunc("/api/merged-test-journeys", visualizations.GetMergedTestJourneys).Methods("GET")
+	router.HandleFunc("/api/step-definitions/report", stepdefs.GetStepDefinitionReport).Methods("GET")
+	router.HandleFunc("/api/parse-cache/stats", parsing.GetParseCacheStats).Methods("GET")
 
 	router.HandleFunc("/optimize", optimize.OptimizeFeatureHandler).Methods("POST")
 	router.HandleFunc("/analyze", analysis.HandleGherkin).Methods("POST")
@@ -5,23 +5,29 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go-similarity-reports/parsing"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 )
 
 type Scenario struct {
-	Name  string
-	Steps []string
-	Tags  []string
-	Data  []map[string]string // Holds example data for the scenarios
+	Name    string
+	Steps   []string
+	Tags    []string
+	Data    []map[string]string // Holds example data for the scenarios
+	Outline bool                // Written back as a Scenario Outline with its Examples
+	Columns []string            // Examples header of an outline, in order
 }
 
 type OptimizeResponse struct {
-	OptimizedContent string   `json:"optimized_content"`
-	NamingIssues     []string `json:"naming_issues,omitempty"` // Omitempty to avoid sending null
+	OptimizedContent string               `json:"optimized_content"`
+	NamingIssues     []string             `json:"naming_issues,omitempty"` // Omitempty to avoid sending null
+	Diagnostics      []parsing.Diagnostic `json:"diagnostics,omitempty"`   // Unreadable or malformed uploads
 }
 
 // Validate the feature name structure
@@ -46,27 +52,29 @@ func validateScenarioNames(scenarios []Scenario) []string {
 	return issues
 }
 
-// Identify common steps for Background
+// Identify common steps for Background: the leading steps every scenario starts with, in order.
+// Only a shared prefix can move to a Background without changing when the steps run.
 func identifyCommonSteps(scenarios []Scenario) []string {
 	if len(scenarios) == 0 {
 		return nil
 	}
 
-	commonSteps := make(map[string]int)
-	for _, scenario := range scenarios {
-		for _, step := range scenario.Steps {
-			commonSteps[step]++
+	sharedSteps := scenarios[0].Steps
+	for _, scenario := range scenarios[1:] {
+		length := 0
+		for length < len(sharedSteps) && length < len(scenario.Steps) && sharedSteps[length] == scenario.Steps[length] {
+			length++
 		}
+		sharedSteps = sharedSteps[:length]
 	}
 
-	var sharedSteps []string
-	for step, count := range commonSteps {
-		if count == len(scenarios) {
-			sharedSteps = append(sharedSteps, step)
+	// A scenario left without steps of its own keeps them instead
+	for _, scenario := range scenarios {
+		if len(scenario.Steps) == len(sharedSteps) {
+			return nil
 		}
 	}
-
-	return sharedSteps
+	return append([]string(nil), sharedSteps...)
 }
 
 // Optimize scenarios by merging identical ones
@@ -81,12 +89,16 @@ func optimizeScenarios(scenarios []Scenario) ([]Scenario, []string) {
 			// If it exists, we can append data but do not overwrite existing steps
 			existingScenario.Data = append(existingScenario.Data, scenario.Data...)
 			existingScenario.Tags = append(existingScenario.Tags, scenario.Tags...) // Merge tags
+			existingScenario.Outline = existingScenario.Outline || scenario.Outline
+			existingScenario.Columns = appendColumns(existingScenario.Columns, scenario.Columns)
 		} else {
 			newScenario := &Scenario{
-				Name:  scenario.Name,
-				Steps: scenario.Steps,
-				Tags:  scenario.Tags,
-				Data:  scenario.Data, // Initialize with scenario Data
+				Name:    scenario.Name,
+				Steps:   scenario.Steps,
+				Tags:    scenario.Tags,
+				Data:    scenario.Data, // Initialize with scenario Data
+				Outline: scenario.Outline,
+				Columns: scenario.Columns,
 			}
 			scenarioMap[key] = newScenario
 		}
@@ -103,14 +115,122 @@ func optimizeScenarios(scenarios []Scenario) ([]Scenario, []string) {
 	return optimizedScenarios, commonSteps
 }
 
+// Add the Examples columns not already in the header, keeping their order
+func appendColumns(columns, more []string) []string {
+	for _, column := range more {
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// Pick the dialect for the combined output: the shared language of all uploads, or English when they differ
+func outputLanguage(features []parsing.Feature) string {
+	language := ""
+	for _, feature := range features {
+		if feature.Language == "" {
+			continue
+		}
+		if language != "" && language != feature.Language {
+			return "en"
+		}
+		language = feature.Language
+	}
+	if language == "" {
+		return "en"
+	}
+	return language
+}
+
+// Convert a parsed feature into optimizer scenarios, prefixing any Background steps.
+// Step keywords are rendered in the output language so mixed-language uploads stay valid Gherkin.
+func scenariosFromFeature(feature parsing.Feature, language string) []Scenario {
+	var scenarios []Scenario
+	collect := func(background []parsing.Step, source []parsing.Scenario) {
+		for _, s := range source {
+			scenario := Scenario{Name: s.Name, Steps: []string{}, Tags: s.Tags, Outline: s.IsOutline()}
+			for _, step := range append(append([]parsing.Step{}, background...), s.Steps...) {
+				scenario.Steps = append(scenario.Steps, renderStep(step, feature.Language, language))
+			}
+			for _, examples := range s.Examples {
+				scenario.Columns = appendColumns(scenario.Columns, examples.Header)
+				for _, row := range examples.Rows {
+					data := make(map[string]string, len(examples.Header))
+					for i, key := range examples.Header {
+						if i < len(row) {
+							data[key] = row[i]
+						}
+					}
+					scenario.Data = append(scenario.Data, data)
+				}
+			}
+			scenarios = append(scenarios, scenario)
+		}
+	}
+
+	var featureBackground []parsing.Step
+	if feature.Background != nil {
+		featureBackground = feature.Background.Steps
+	}
+	collect(featureBackground, feature.Scenarios)
+	for _, rule := range feature.Rules {
+		ruleBackground := featureBackground
+		if rule.Background != nil {
+			ruleBackground = append(append([]parsing.Step{}, featureBackground...), rule.Background.Steps...)
+		}
+		collect(ruleBackground, rule.Scenarios)
+	}
+	return scenarios
+}
+
+// Render a step in the output language, followed by its doc string or data table indented below it.
+// Keeping the argument in the step means steps only merge or move to the Background when their arguments match.
+func renderStep(step parsing.Step, from, to string) string {
+	var output strings.Builder
+	output.WriteString(parsing.TranslateStep(step, from, to))
+	if step.DocString != nil {
+		delimiter := `"""`
+		if strings.Contains(step.DocString.Content, delimiter) {
+			delimiter = "```"
+		}
+		output.WriteString("\n    " + delimiter + step.DocString.MediaType)
+		for _, line := range strings.Split(step.DocString.Content, "\n") {
+			output.WriteString("\n    " + line)
+		}
+		output.WriteString("\n    " + delimiter)
+	}
+	for _, row := range step.DataTable {
+		output.WriteString("\n    " + tableRow(row))
+	}
+	return output.String()
+}
+
+var tableEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", `\n`)
+
+// Render a Gherkin table row, escaping the characters that would end or split a cell
+func tableRow(cells []string) string {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = tableEscaper.Replace(cell)
+	}
+	return "| " + strings.Join(escaped, " | ") + " |"
+}
+
 // Generate the optimized content, including Background if applicable
-func writeOptimizedContent(featureName string, optimizedScenarios []Scenario, commonSteps []string) string {
+func writeOptimizedContent(featureName, language string, optimizedScenarios []Scenario, commonSteps []string) string {
 	var output bytes.Buffer
-	output.WriteString("Feature: " + featureName + "\n")
+	dialect := parsing.Dialect(language)
+	scenarioKeywords := dialect.ScenarioKeywords()
+	scenarioKeyword := scenarioKeywords[len(scenarioKeywords)-1] // Dialects list the "Example" synonym first
+	if dialect.Language != "en" {
+		output.WriteString("# language: " + dialect.Language + "\n")
+	}
+	output.WriteString(dialect.FeatureKeywords()[0] + ": " + featureName + "\n")
 
 	// If there are common steps, add Background
 	if len(commonSteps) > 0 {
-		output.WriteString("Background:\n")
+		output.WriteString(dialect.BackgroundKeywords()[0] + ":\n")
 		for _, step := range commonSteps {
 			output.WriteString("  " + step + "\n")
 		}
@@ -118,12 +238,33 @@ func writeOptimizedContent(featureName string, optimizedScenarios []Scenario, co
 
 	// Iterate over the optimized scenarios and write them
 	for _, scenario := range optimizedScenarios {
-		output.WriteString("Scenario: " + scenario.Name + "\n")
+		keyword := scenarioKeyword
+		if scenario.Outline {
+			keyword = dialect.ScenarioOutlineKeywords()[0]
+		}
+		output.WriteString(keyword + ": " + scenario.Name + "\n")
 
-		// Write steps for each scenario
-		for _, step := range scenario.Steps {
+		// Write steps for each scenario, leaving out those already run by the Background
+		steps := scenario.Steps
+		if len(commonSteps) > 0 && len(steps) >= len(commonSteps) && slices.Equal(steps[:len(commonSteps)], commonSteps) {
+			steps = steps[len(commonSteps):]
+		}
+		for _, step := range steps {
 			output.WriteString("  " + step + "\n")
 		}
+
+		// Outlines keep the rows of all their Examples tables, under one header
+		if scenario.Outline && len(scenario.Columns) > 0 {
+			output.WriteString("\n  " + dialect.ExamplesKeywords()[0] + ":\n")
+			output.WriteString("    " + tableRow(scenario.Columns) + "\n")
+			for _, data := range scenario.Data {
+				row := make([]string, len(scenario.Columns))
+				for i, column := range scenario.Columns {
+					row[i] = data[column]
+				}
+				output.WriteString("    " + tableRow(row) + "\n")
+			}
+		}
 	}
 
 	return output.String()
@@ -140,9 +281,15 @@ func OptimizeFeatureHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var allScenarios []Scenario
-	errorsChan := make(chan error, 10) // Channel for error handling
-	var wg sync.WaitGroup              // WaitGroup to manage goroutines
+	var features []parsing.Feature
+	var diagnostics []parsing.Diagnostic // Problems with individual uploads
+	var wg sync.WaitGroup                // WaitGroup to manage goroutines
+	var mu sync.Mutex                    // Guards features and diagnostics across goroutines
+	report := func(found ...parsing.Diagnostic) {
+		mu.Lock()
+		diagnostics = append(diagnostics, found...)
+		mu.Unlock()
+	}
 
 	// Process multiple uploaded files
 	for _, fheaders := range r.MultipartForm.File {
@@ -155,7 +302,7 @@ func OptimizeFeatureHandler(w http.ResponseWriter, r *http.Request) {
 				// Open the uploaded file
 				uploadedFile, err := fh.Open()
 				if err != nil {
-					errorsChan <- fmt.Errorf("error opening file: %s, %v", fh.Filename, err)
+					report(parsing.Diagnostic{File: fh.Filename, Severity: parsing.SeverityError, Message: "error opening file: " + err.Error()})
 					return
 				}
 				defer uploadedFile.Close()
@@ -163,49 +310,36 @@ func OptimizeFeatureHandler(w http.ResponseWriter, r *http.Request) {
 				// Read the content of the file
 				content, err := io.ReadAll(uploadedFile)
 				if err != nil {
-					errorsChan <- fmt.Errorf("error reading file content: %s, %v", fh.Filename, err)
+					report(parsing.Diagnostic{File: fh.Filename, Severity: parsing.SeverityError, Message: "error reading file content: " + err.Error()})
 					return
 				}
 
-				// Split content into lines to parse scenarios
-				lines := strings.Split(string(content), "\n")
-				var currentScenario Scenario
-
-				for _, line := range lines {
-					trimmed := strings.TrimSpace(line)
-					if strings.HasPrefix(trimmed, "Scenario:") {
-						// Finish collecting the previous scenario
-						if currentScenario.Name != "" {
-							allScenarios = append(allScenarios, currentScenario) // Save previous scenario
-						}
-						currentScenario = Scenario{Name: strings.TrimSpace(strings.TrimPrefix(trimmed, "Scenario:"))}
-						currentScenario.Steps = []string{}
-					} else if strings.HasPrefix(trimmed, "@") {
-						// Handle tags
-						currentScenario.Tags = append(currentScenario.Tags, strings.TrimSpace(trimmed))
-					} else if strings.HasPrefix(trimmed, "Given") ||
-						strings.HasPrefix(trimmed, "When") ||
-						strings.HasPrefix(trimmed, "Then") {
-						currentScenario.Steps = append(currentScenario.Steps, trimmed)
-					}
+				// Parse the content with the shared Gherkin model
+				feature, err := parsing.ParseFeature(bytes.NewReader(content), fh.Filename)
+				if err != nil {
+					report(parsing.ErrorDiagnostics(fh.Filename, err)...)
+					return
 				}
 
-				// Append the last collected scenario if it exists
-				if currentScenario.Name != "" {
-					allScenarios = append(allScenarios, currentScenario)
-				}
+				report(parsing.CheckFeature(*feature)...)
+				mu.Lock()
+				features = append(features, *feature)
+				mu.Unlock()
 			}(file) // Pass the file header to the goroutine
 		}
 	}
 
 	// Wait for all goroutines to finish
 	wg.Wait()
-	close(errorsChan) // Close the channel when done
 
-	// Check for errors after processing all files
-	for err := range errorsChan {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	// Uploads finish in any order; sort them so the output is stable
+	sort.Slice(features, func(i, j int) bool { return features[i].Path < features[j].Path })
+	sort.SliceStable(diagnostics, func(i, j int) bool { return diagnostics[i].File < diagnostics[j].File })
+	language := outputLanguage(features)
+
+	var allScenarios []Scenario
+	for _, feature := range features {
+		allScenarios = append(allScenarios, scenariosFromFeature(feature, language)...)
 	}
 
 	// Validate the feature name
@@ -224,12 +358,13 @@ func OptimizeFeatureHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Optimize scenarios and prepare optimized content
 	optimizedScenarios, commonSteps := optimizeScenarios(allScenarios)
-	optimizedContent := writeOptimizedContent(featureName, optimizedScenarios, commonSteps)
+	optimizedContent := writeOptimizedContent(featureName, language, optimizedScenarios, commonSteps)
 
 	// Prepare response structure
 	response := OptimizeResponse{
 		OptimizedContent: optimizedContent,
 		NamingIssues:     namingIssues,
+		Diagnostics:      diagnostics,
 	}
 
 	// Send the response
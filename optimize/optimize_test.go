@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"go-similarity-reports/parsing"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -159,3 +161,169 @@ func contains(slice []string, item string) bool {
 	}
 	return false
 }
+
+// Test that Background, And and But steps reach the optimizer
+func TestScenariosFromFeature(t *testing.T) {
+	featureContent := `Feature: User login
+  Background:
+    Given the login page is open
+
+  Scenario: Successful login
+    Given I have a valid username "user1"
+    And I have a valid password
+    When I perform the login action
+    Then I should see a welcome message
+    But I should not see an error`
+
+	feature, err := parsing.ParseFeature(strings.NewReader(featureContent), "login.feature")
+	if err != nil {
+		t.Fatalf("Failed to parse feature: %v", err)
+	}
+
+	scenarios := scenariosFromFeature(*feature, "en")
+	if len(scenarios) != 1 {
+		t.Fatalf("Expected 1 scenario, got %d", len(scenarios))
+	}
+	if len(scenarios[0].Steps) != 6 {
+		t.Errorf("Expected 6 steps, got %d: %v", len(scenarios[0].Steps), scenarios[0].Steps)
+	}
+	if scenarios[0].Steps[0] != "Given the login page is open" {
+		t.Errorf("Expected background step first, got %q", scenarios[0].Steps[0])
+	}
+}
+
+// Test that German features keep their dialect through optimization
+func TestOptimizeGermanFeature(t *testing.T) {
+	featureContent := `# language: de
+Funktionalität: Anmeldung
+  Szenario: Erfolgreiche Anmeldung
+    Angenommen ich bin auf der Anmeldeseite
+    Und ich habe ein Konto
+    Wenn ich mich anmelde
+    Dann sehe ich das Dashboard`
+
+	feature, err := parsing.ParseFeature(strings.NewReader(featureContent), "anmeldung.feature")
+	if err != nil {
+		t.Fatalf("Failed to parse feature: %v", err)
+	}
+	if feature.Language != "de" || len(feature.Scenarios[0].Steps) != 4 {
+		t.Fatalf("Expected 4 German steps, got %+v", feature.Scenarios)
+	}
+	if kind := feature.Scenarios[0].Steps[1].Kind; kind != parsing.KindContext {
+		t.Errorf("Expected Und to inherit the context kind, got %q", kind)
+	}
+
+	language := outputLanguage([]parsing.Feature{*feature})
+	scenarios := scenariosFromFeature(*feature, language)
+	content := writeOptimizedContent("Anmeldung", language, scenarios, nil)
+	if !strings.HasPrefix(content, "# language: de\nFunktionalität: Anmeldung\nSzenario: Erfolgreiche Anmeldung\n") {
+		t.Errorf("Expected German keywords in output, got:\n%s", content)
+	}
+
+	// Mixed uploads fall back to English keywords for every step
+	english := scenariosFromFeature(*feature, "en")
+	if english[0].Steps[1] != "And ich habe ein Konto" || english[0].Steps[3] != "Then sehe ich das Dashboard" {
+		t.Errorf("Expected translated keywords, got %v", english[0].Steps)
+	}
+}
+
+// Test that Background steps are written once, not again in every scenario
+func TestWriteOptimizedContentBackground(t *testing.T) {
+	featureContent := `Feature: Dashboard
+  Background:
+    Given the page is open
+    And I am logged in
+
+  Scenario: See the dashboard
+    Then I see the dashboard
+
+  Scenario: See my profile
+    When I open my profile
+    Then I see my name`
+
+	feature, err := parsing.ParseFeature(strings.NewReader(featureContent), "dashboard.feature")
+	if err != nil {
+		t.Fatalf("Failed to parse feature: %v", err)
+	}
+
+	optimizedScenarios, commonSteps := optimizeScenarios(scenariosFromFeature(*feature, "en"))
+	if len(commonSteps) != 2 || commonSteps[0] != "Given the page is open" || commonSteps[1] != "And I am logged in" {
+		t.Fatalf("Expected the Background steps in order, got %v", commonSteps)
+	}
+	content := writeOptimizedContent("Dashboard", "en", optimizedScenarios, commonSteps)
+	for _, step := range commonSteps {
+		if count := strings.Count(content, step); count != 1 {
+			t.Errorf("Expected %q once, got %d times in:\n%s", step, count, content)
+		}
+	}
+	if !strings.Contains(content, "Scenario: See the dashboard\n  Then I see the dashboard\n") {
+		t.Errorf("Expected the scenario's own steps after the Background, got:\n%s", content)
+	}
+
+	// A step every scenario uses at a different position stays in place
+	scenarios := []Scenario{
+		{Name: "First", Steps: []string{"Given A", "Then B"}},
+		{Name: "Second", Steps: []string{"Given C", "Then B"}},
+	}
+	if common := identifyCommonSteps(scenarios); len(common) != 0 {
+		t.Errorf("Expected no Background, got %v", common)
+	}
+}
+
+func TestWriteOptimizedContentOutline(t *testing.T) {
+	featureContent := `Feature: Payments
+  Scenario Outline: Pay an amount
+    Given I have a balance of <balance>
+    When I pay <amount> to:
+      | name  | iban    |
+      | Alice | DE12\|3 |
+    Then the balance is <left>
+
+    Examples: Small
+      | balance | amount | left |
+      | 100     | 10     | 90   |
+
+    Examples: Large
+      | balance | amount | left |
+      | 1000    | 500    | 500  |
+
+  Scenario: Send a receipt
+    When I send the receipt:
+      """json
+      { "total": 10 }
+      """
+    Then the receipt is sent`
+
+	feature, err := parsing.ParseFeature(strings.NewReader(featureContent), "payments.feature")
+	if err != nil {
+		t.Fatalf("Failed to parse feature: %v", err)
+	}
+	optimizedScenarios, commonSteps := optimizeScenarios(scenariosFromFeature(*feature, "en"))
+	content := writeOptimizedContent("Payments", "en", optimizedScenarios, commonSteps)
+
+	// The output is valid Gherkin with the outline, its rows and the step arguments intact
+	written, err := parsing.ParseFeature(strings.NewReader(content), "optimized.feature")
+	if err != nil {
+		t.Fatalf("Expected the output to parse, got %v in:\n%s", err, content)
+	}
+	if len(written.Scenarios) != 2 {
+		t.Fatalf("Expected 2 scenarios, got %d in:\n%s", len(written.Scenarios), content)
+	}
+	for _, scenario := range written.Scenarios {
+		switch scenario.Name {
+		case "Pay an amount":
+			if !scenario.IsOutline() || len(scenario.Examples) != 1 || len(scenario.Examples[0].Rows) != 2 {
+				t.Errorf("Expected an outline with both rows, got:\n%s", content)
+			}
+			if table := scenario.Steps[1].DataTable; len(table) != 2 || table[1][1] != "DE12|3" {
+				t.Errorf("Expected the data table to be kept, got %v", table)
+			}
+		case "Send a receipt":
+			if doc := scenario.Steps[0].DocString; doc == nil || doc.MediaType != "json" || doc.Content != `{ "total": 10 }` {
+				t.Errorf("Expected the doc string to be kept, got %+v", doc)
+			}
+		default:
+			t.Errorf("Unexpected scenario %q", scenario.Name)
+		}
+	}
+}
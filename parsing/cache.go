@@ -0,0 +1,226 @@
+package parsing
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheEntries is the most files DefaultCache holds before evicting the least recently used
+const DefaultCacheEntries = 20000
+
+// ParseCache keeps the parsed model of every feature file so unchanged files are not re-parsed.
+// Entries are keyed by absolute path; a file is reused when its size and mtime are unchanged,
+// or when it was touched but its content hash is still the same.
+// Beyond maxEntries files the least recently used entry is evicted.
+type ParseCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element // Elements of order, holding a *cacheEntry
+	order      *list.List               // Most recently used first
+	maxEntries int
+	stats      CacheStats
+}
+
+type cacheEntry struct {
+	key         string
+	modTime     time.Time
+	size        int64
+	hash        [sha256.Size]byte
+	feature     *Feature     // Nil when the file failed to parse
+	diagnostics []Diagnostic // Syntax errors and warnings found when the file was parsed
+}
+
+// CacheStats counts how parse requests were served
+type CacheStats struct {
+	Entries   int   `json:"entries"`
+	Hits      int64 `json:"hits"`       // Served from cache because size and mtime were unchanged
+	HashHits  int64 `json:"hash_hits"`  // Re-read because mtime changed, but content hash was unchanged
+	Misses    int64 `json:"misses"`     // Parsed because the file was new or its content changed
+	ReadFails int64 `json:"read_fails"` // Files that could not be read
+	Evictions int64 `json:"evictions"`  // Entries dropped for the size limit or because their file was deleted
+}
+
+// DefaultCache is shared by every endpoint that parses a directory
+var DefaultCache = NewParseCache()
+
+func NewParseCache() *ParseCache {
+	return NewParseCacheSize(DefaultCacheEntries)
+}
+
+// NewParseCacheSize creates a cache holding at most maxEntries files
+func NewParseCacheSize(maxEntries int) *ParseCache {
+	return &ParseCache{entries: make(map[string]*list.Element), order: list.New(), maxEntries: maxEntries}
+}
+
+// Load returns the parsed feature for a file, parsing it only when its content changed.
+// The returned feature and diagnostics report rel as their path.
+func (c *ParseCache) Load(path, rel string) (*Feature, []Diagnostic) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		key = path
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		c.count(func(s *CacheStats) { s.ReadFails++ })
+		return nil, []Diagnostic{{File: rel, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	c.mu.Lock()
+	var entry *cacheEntry
+	element, found := c.entries[key]
+	if found {
+		entry = element.Value.(*cacheEntry)
+		c.order.MoveToFront(element)
+	}
+	if found && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		c.stats.Hits++
+		c.mu.Unlock()
+		return entry.result(rel)
+	}
+	c.mu.Unlock()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		c.count(func(s *CacheStats) { s.ReadFails++ })
+		return nil, []Diagnostic{{File: rel, Severity: SeverityError, Message: err.Error()}}
+	}
+	hash := sha256.Sum256(content)
+
+	c.mu.Lock()
+	if found && entry.hash == hash {
+		c.stats.HashHits++
+		entry.modTime, entry.size = info.ModTime(), info.Size()
+		c.mu.Unlock()
+		return entry.result(rel)
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// Parse outside the lock so concurrent requests don't wait on each other
+	entry = &cacheEntry{key: key, modTime: info.ModTime(), size: info.Size(), hash: hash}
+	feature, err := ParseFeature(bytes.NewReader(content), rel)
+	if err != nil {
+		entry.diagnostics = ErrorDiagnostics(rel, err)
+	} else {
+		entry.feature = feature
+		entry.diagnostics = CheckFeature(*feature)
+	}
+
+	c.mu.Lock()
+	c.store(entry)
+	c.mu.Unlock()
+	return entry.result(rel)
+}
+
+// Add or replace an entry as the most recently used, evicting the least recently used beyond the limit.
+// The caller holds c.mu.
+func (c *ParseCache) store(entry *cacheEntry) {
+	if element, found := c.entries[entry.key]; found {
+		element.Value = entry
+		c.order.MoveToFront(element)
+	} else {
+		c.entries[entry.key] = c.order.PushFront(entry)
+	}
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+// The caller holds c.mu
+func (c *ParseCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+	c.stats.Evictions++
+}
+
+// Prune drops the entries below root that a walk no longer found and whose file is gone, e.g. after a rename.
+// Files the walk only left out through include or exclude patterns are kept.
+func (c *ParseCache) Prune(root string, files []string) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return
+	}
+	found := make(map[string]bool, len(files))
+	for _, file := range files {
+		found[filepath.Join(absRoot, filepath.FromSlash(file))] = true
+	}
+
+	prefix := absRoot + string(filepath.Separator)
+	var missing []string
+	c.mu.Lock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) && !found[key] {
+			missing = append(missing, key)
+		}
+	}
+	c.mu.Unlock()
+
+	// Check the files outside the lock so loads are not held up
+	var gone []string
+	for _, key := range missing {
+		if _, err := os.Stat(key); os.IsNotExist(err) {
+			gone = append(gone, key)
+		}
+	}
+
+	c.mu.Lock()
+	for _, key := range gone {
+		if element, found := c.entries[key]; found {
+			c.remove(element)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Copy the cached result so callers can't see another root's relative path
+func (e *cacheEntry) result(rel string) (*Feature, []Diagnostic) {
+	diagnostics := make([]Diagnostic, len(e.diagnostics))
+	for i, diagnostic := range e.diagnostics {
+		diagnostic.File = rel
+		diagnostics[i] = diagnostic
+	}
+	if e.feature == nil {
+		return nil, diagnostics
+	}
+	feature := *e.feature
+	feature.Path = rel
+	return &feature, diagnostics
+}
+
+func (c *ParseCache) count(update func(*CacheStats)) {
+	c.mu.Lock()
+	update(&c.stats)
+	c.mu.Unlock()
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *ParseCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// Clear drops every cached file and resets the counters
+func (c *ParseCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.stats = CacheStats{}
+}
+
+// Endpoint to get the parse cache statistics
+func GetParseCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DefaultCache.Stats())
+}
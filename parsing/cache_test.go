@@ -0,0 +1,100 @@
+package parsing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFeature(t, dir, "login.feature", "Feature: Login\n  Scenario: Log in\n    Given I log in\n")
+	path := filepath.Join(dir, "login.feature")
+	cache := NewParseCache()
+
+	feature, _ := cache.Load(path, "login.feature")
+	if feature == nil || feature.Name != "Login" {
+		t.Fatalf("Expected the feature to be parsed, got %+v", feature)
+	}
+	feature, _ = cache.Load(path, "nested/login.feature")
+	if feature.Path != "nested/login.feature" {
+		t.Errorf("Expected the cached feature to report the requested path, got %q", feature.Path)
+	}
+
+	stats := cache.Stats()
+	if stats.Misses != 1 || stats.Hits != 1 || stats.Entries != 1 {
+		t.Errorf("Expected 1 miss and 1 hit, got %+v", stats)
+	}
+
+	// Touching the file without changing it only costs a hash
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Error touching file: %v", err)
+	}
+	cache.Load(path, "login.feature")
+	if stats = cache.Stats(); stats.HashHits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected a hash hit, got %+v", stats)
+	}
+
+	// Changing the content re-parses the file
+	writeFeature(t, dir, "login.feature", "Feature: Sign in\n  Scenario: Sign in\n    Given I sign in\n")
+	feature, _ = cache.Load(path, "login.feature")
+	if feature.Name != "Sign in" {
+		t.Errorf("Expected the modified feature, got %q", feature.Name)
+	}
+	if stats = cache.Stats(); stats.Misses != 2 {
+		t.Errorf("Expected a second miss, got %+v", stats)
+	}
+
+	cache.Clear()
+	if stats = cache.Stats(); stats.Entries != 0 || stats.Hits != 0 {
+		t.Errorf("Expected an empty cache, got %+v", stats)
+	}
+}
+
+func TestParseCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.feature", "b.feature", "c.feature"} {
+		writeFeature(t, dir, name, "Feature: "+name+"\n  Scenario: Log in\n    Given I log in\n")
+	}
+	cache := NewParseCacheSize(2)
+
+	cache.Load(filepath.Join(dir, "a.feature"), "a.feature")
+	cache.Load(filepath.Join(dir, "b.feature"), "b.feature")
+	// Using a again makes b the least recently used
+	cache.Load(filepath.Join(dir, "a.feature"), "a.feature")
+	cache.Load(filepath.Join(dir, "c.feature"), "c.feature")
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("Expected 2 entries after 1 eviction, got %+v", stats)
+	}
+
+	cache.Load(filepath.Join(dir, "a.feature"), "a.feature")
+	cache.Load(filepath.Join(dir, "b.feature"), "b.feature")
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 4 {
+		t.Errorf("Expected a to be kept and b to be parsed again, got %+v", stats)
+	}
+}
+
+func TestParseCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"login.feature", "search.feature", "draft.feature"} {
+		writeFeature(t, dir, name, "Feature: "+name+"\n  Scenario: Log in\n    Given I log in\n")
+	}
+	other := t.TempDir()
+	writeFeature(t, other, "login.feature", "Feature: Other\n  Scenario: Log in\n    Given I log in\n")
+	cache := NewParseCache()
+	for _, name := range []string{"login.feature", "search.feature", "draft.feature"} {
+		cache.Load(filepath.Join(dir, name), name)
+	}
+	cache.Load(filepath.Join(other, "login.feature"), "login.feature")
+
+	// The renamed file is dropped; the excluded draft and the other directory are kept
+	if err := os.Rename(filepath.Join(dir, "search.feature"), filepath.Join(dir, "find.feature")); err != nil {
+		t.Fatalf("Error renaming file: %v", err)
+	}
+	cache.Prune(dir, []string{"login.feature", "find.feature"})
+	if stats := cache.Stats(); stats.Entries != 3 || stats.Evictions != 1 {
+		t.Errorf("Expected the renamed file to be evicted, got %+v", stats)
+	}
+}
@@ -0,0 +1,69 @@
+package parsing
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severity of a parse diagnostic
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic reports a problem with a single feature file without aborting the whole run
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// The Gherkin parser formats each syntax error as "(line:column): message"
+var parseErrorPattern = regexp.MustCompile(`(?m)^\((\d+):(\d+)\): (.*)$`)
+
+// ErrorDiagnostics converts a read or parse error for a file into diagnostics, one per syntax error
+func ErrorDiagnostics(file string, err error) []Diagnostic {
+	matches := parseErrorPattern.FindAllStringSubmatch(err.Error(), -1)
+	if len(matches) == 0 {
+		return []Diagnostic{{File: file, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	diagnostics := make([]Diagnostic, 0, len(matches))
+	for _, match := range matches {
+		line, _ := strconv.Atoi(match[1])
+		column, _ := strconv.Atoi(match[2])
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     file,
+			Line:     line,
+			Column:   column,
+			Severity: SeverityError,
+			Message:  strings.TrimSpace(match[3]),
+		})
+	}
+	return diagnostics
+}
+
+// CheckFeature reports warnings for a feature that parsed but has nothing to compare
+func CheckFeature(feature Feature) []Diagnostic {
+	if feature.Name == "" && feature.Line == 0 {
+		return []Diagnostic{{File: feature.Path, Severity: SeverityWarning, Message: "file contains no Feature"}}
+	}
+
+	var diagnostics []Diagnostic
+	for _, scenario := range feature.AllScenarios() {
+		if len(scenario.Steps) == 0 {
+			diagnostics = append(diagnostics, Diagnostic{
+				File:     feature.Path,
+				Line:     scenario.Line,
+				Severity: SeverityWarning,
+				Message:  "scenario \"" + scenario.Name + "\" has no steps",
+			})
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,52 @@
+package parsing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFeaturesDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	writeFeature(t, dir, "good.feature", "Feature: Good\n  Scenario: Works\n    Given something\n")
+	writeFeature(t, dir, "broken.feature", "Feature: Broken\n  Scenario: Fails\n    Given something\n  Nonsense line\n")
+	writeFeature(t, dir, "empty.feature", "Feature: Empty\n  Scenario: Nothing here\n")
+	writeFeature(t, dir, "unreadable.feature", "Feature: Hidden\n")
+	if err := os.Chmod(filepath.Join(dir, "unreadable.feature"), 0o000); err != nil {
+		t.Fatalf("Error changing permissions: %v", err)
+	}
+
+	features, diagnostics, err := ParseFeatures(dir, WalkOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Malformed files are skipped, everything else is still parsed
+	if len(features) != 2 && len(features) != 3 {
+		t.Fatalf("Expected the good and empty features to be parsed, got %d", len(features))
+	}
+
+	byFile := map[string]Diagnostic{}
+	for _, diagnostic := range diagnostics {
+		byFile[diagnostic.File] = diagnostic
+	}
+
+	broken, found := byFile["broken.feature"]
+	if !found || broken.Severity != SeverityError || broken.Line != 4 || broken.Column != 3 {
+		t.Errorf("Expected a syntax error at 4:3 for broken.feature, got %+v", broken)
+	}
+	empty, found := byFile["empty.feature"]
+	if !found || empty.Severity != SeverityWarning || empty.Line != 2 {
+		t.Errorf("Expected an empty scenario warning at line 2, got %+v", empty)
+	}
+	if _, found := byFile["good.feature"]; found {
+		t.Errorf("Expected no diagnostics for good.feature")
+	}
+
+	// Running as root can still read the file, so only check when it was actually unreadable
+	if len(features) == 2 {
+		if unreadable, found := byFile["unreadable.feature"]; !found || unreadable.Severity != SeverityError {
+			t.Errorf("Expected a read error for unreadable.feature, got %+v", unreadable)
+		}
+	}
+}
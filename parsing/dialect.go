@@ -0,0 +1,81 @@
+package parsing
+
+import (
+	"strings"
+
+	gherkin "github.com/cucumber/gherkin/go/v27"
+	messages "github.com/cucumber/messages/go/v22"
+)
+
+// StepKind is the language-neutral role of a step, so Given/Angenommen/Dado all compare equal
+type StepKind string
+
+const (
+	KindContext StepKind = "context"
+	KindAction  StepKind = "action"
+	KindOutcome StepKind = "outcome"
+)
+
+// Dialect returns the built-in Gherkin dialect for a language code, falling back to English
+func Dialect(language string) *gherkin.Dialect {
+	if dialect := gherkin.DialectsBuiltin().GetDialect(language); dialect != nil {
+		return dialect
+	}
+	return gherkin.DialectsBuiltin().GetDialect(gherkin.DefaultDialect)
+}
+
+// Resolve the kind of a step from its keyword type; And, But and * inherit the previous kind
+func stepKind(keywordType messages.StepKeywordType, previous StepKind) StepKind {
+	switch keywordType {
+	case messages.StepKeywordType_CONTEXT:
+		return KindContext
+	case messages.StepKeywordType_ACTION:
+		return KindAction
+	case messages.StepKeywordType_OUTCOME:
+		return KindOutcome
+	}
+	if previous == "" {
+		return KindContext
+	}
+	return previous
+}
+
+// StepKeyword renders the keyword for a step kind in the given language.
+// Conjunctions become the dialect's "And" so translated scenarios keep their shape.
+func StepKeyword(language string, kind StepKind, conjunction bool) string {
+	dialect := Dialect(language)
+	key := "given"
+	switch {
+	case conjunction:
+		key = "and"
+	case kind == KindAction:
+		key = "when"
+	case kind == KindOutcome:
+		key = "then"
+	}
+	for _, keyword := range dialect.Keywords[key] {
+		if keyword != "* " {
+			return strings.TrimSpace(keyword)
+		}
+	}
+	return "*"
+}
+
+// IsConjunction reports whether a step keyword is an And/But style keyword in its dialect
+func IsConjunction(language, keyword string) bool {
+	dialect := Dialect(language)
+	for _, candidate := range append(dialect.Keywords["and"], dialect.Keywords["but"]...) {
+		if candidate != "* " && strings.TrimSpace(candidate) == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// TranslateStep renders a step with keywords from another dialect, keeping its text
+func TranslateStep(step Step, from, to string) string {
+	if from == to {
+		return step.Keyword + " " + step.Text
+	}
+	return StepKeyword(to, step.Kind, IsConjunction(from, step.Keyword)) + " " + step.Text
+}
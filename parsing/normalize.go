@@ -0,0 +1,110 @@
+package parsing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Normalizer rewrites step parameters into typed placeholders so steps can be compared as templates,
+// e.g. `I transfer "100" to "alice"` becomes `I transfer <number> to <string>`
+type Normalizer struct {
+	Strings  bool `json:"strings"`
+	Numbers  bool `json:"numbers"`
+	Dates    bool `json:"dates"`
+	Emails   bool `json:"emails"`
+	Payloads bool `json:"payloads"`
+}
+
+var (
+	quotedPattern = regexp.MustCompile(`"[^"]*"`)
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	datePattern   = regexp.MustCompile(`\b(?:\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2})?)?|\d{1,2}[/.]\d{1,2}[/.]\d{2,4})\b`)
+	numberPattern = regexp.MustCompile(`\b\d+(?:[.,]\d+)*\b`)
+)
+
+// ParseNormalizer reads a comma separated list of rules; "all" enables every rule and "" disables normalisation
+func ParseNormalizer(spec string) (*Normalizer, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	n := &Normalizer{}
+	for _, rule := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(rule) {
+		case "all":
+			n.Strings, n.Numbers, n.Dates, n.Emails, n.Payloads = true, true, true, true, true
+		case "strings":
+			n.Strings = true
+		case "numbers":
+			n.Numbers = true
+		case "dates":
+			n.Dates = true
+		case "emails":
+			n.Emails = true
+		case "payloads":
+			n.Payloads = true
+		default:
+			return nil, fmt.Errorf("unknown normalize rule %q (expected strings, numbers, dates, emails, payloads or all)", rule)
+		}
+	}
+	return n, nil
+}
+
+// Template renders a step's text with its parameters replaced and, when enabled, a placeholder for its argument
+func (n Normalizer) Template(step Step) string {
+	text := n.Text(step.Text)
+	if n.Payloads {
+		if step.DocString != nil {
+			text += " <docstring>"
+		}
+		if len(step.DataTable) > 0 {
+			text += " <table>"
+		}
+	}
+	return text
+}
+
+// Text replaces the parameters of a single step text
+func (n Normalizer) Text(text string) string {
+	// Quoted values are typed by their content so "100" and 100 normalise alike
+	text = quotedPattern.ReplaceAllStringFunc(text, func(quoted string) string {
+		inner := quoted[1 : len(quoted)-1]
+		if placeholder := n.classify(inner); placeholder != "" {
+			return placeholder
+		}
+		if n.Strings {
+			return "<string>"
+		}
+		return quoted
+	})
+
+	if n.Emails {
+		text = emailPattern.ReplaceAllString(text, "<email>")
+	}
+	if n.Dates {
+		text = datePattern.ReplaceAllString(text, "<date>")
+	}
+	if n.Numbers {
+		text = numberPattern.ReplaceAllString(text, "<number>")
+	}
+	return text
+}
+
+// Placeholder for a value that is entirely an email, date or number, if that rule is enabled
+func (n Normalizer) classify(value string) string {
+	switch {
+	case n.Emails && fullMatch(emailPattern, value):
+		return "<email>"
+	case n.Dates && fullMatch(datePattern, value):
+		return "<date>"
+	case n.Numbers && fullMatch(numberPattern, value):
+		return "<number>"
+	}
+	return ""
+}
+
+func fullMatch(pattern *regexp.Regexp, value string) bool {
+	loc := pattern.FindStringIndex(value)
+	return loc != nil && loc[0] == 0 && loc[1] == len(value)
+}
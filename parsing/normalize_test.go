@@ -0,0 +1,55 @@
+package parsing
+
+import "testing"
+
+func TestNormalizerText(t *testing.T) {
+	all, err := ParseNormalizer("all")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	testCases := []struct {
+		normalizer *Normalizer
+		input      string
+		expected   string
+	}{
+		{all, `I transfer "100" to "alice"`, `I transfer <number> to <string>`},
+		{all, `I transfer "250" to "bob"`, `I transfer <number> to <string>`},
+		{all, `I email bob@example.com on 2024-01-31`, `I email <email> on <date>`},
+		{all, `the total is 12.50 after 3 days`, `the total is <number> after <number> days`},
+		{all, `I open step2 of the wizard`, `I open step2 of the wizard`},
+		{&Normalizer{Strings: true}, `I transfer "100" to "alice"`, `I transfer <string> to <string>`},
+		{&Normalizer{Numbers: true}, `I transfer "100" to "alice"`, `I transfer <number> to "alice"`},
+	}
+
+	for _, tc := range testCases {
+		if result := tc.normalizer.Text(tc.input); result != tc.expected {
+			t.Errorf("Expected %q, got %q", tc.expected, result)
+		}
+	}
+}
+
+func TestNormalizerTemplatePayloads(t *testing.T) {
+	step := Step{Text: "I submit the form", DocString: &DocString{Content: "{}"}}
+	if result := (Normalizer{Payloads: true}).Template(step); result != "I submit the form <docstring>" {
+		t.Errorf("Expected doc string placeholder, got %q", result)
+	}
+
+	step = Step{Text: "the users exist", DataTable: [][]string{{"name"}, {"alice"}}}
+	if result := (Normalizer{Payloads: true}).Template(step); result != "the users exist <table>" {
+		t.Errorf("Expected table placeholder, got %q", result)
+	}
+}
+
+func TestParseNormalizer(t *testing.T) {
+	if n, err := ParseNormalizer(""); err != nil || n != nil {
+		t.Errorf("Expected normalisation to be disabled, got %+v (%v)", n, err)
+	}
+	n, err := ParseNormalizer("strings, emails")
+	if err != nil || !n.Strings || !n.Emails || n.Numbers {
+		t.Errorf("Unexpected normalizer: %+v (%v)", n, err)
+	}
+	if _, err := ParseNormalizer("colours"); err == nil {
+		t.Error("Expected an error for an unknown rule")
+	}
+}
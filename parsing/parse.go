@@ -1,37 +1,325 @@
 package parsing
 
 import (
-	"os"
-	"regexp"
+	"io"
+	"path/filepath"
 	"strings"
+
+	gherkin "github.com/cucumber/gherkin/go/v27"
+	messages "github.com/cucumber/messages/go/v22"
 )
 
+// Test is the flattened view of a feature used by the similarity and journey code
 type Test struct {
-	Name  string   `json:"name"`
-	Steps []string `json:"steps"`
+	Name        string   `json:"name"`
+	Ref         TestRef  `json:"ref"`
+	Steps       []string `json:"steps"`
+	Templates   []string `json:"templates,omitempty"`   // Normalised steps, only set when a Normalizer is configured
+	Definitions []string `json:"definitions,omitempty"` // Step definition patterns, only set when steps are bound
+	Source      []Step   `json:"-"`                     // Structured steps the strings were rendered from
 }
 
-// Parse feature files in the specified directory
-func ParseFeatureFiles(path string) ([]Test, error) {
-	files, err := os.ReadDir(path)
+// Feature is the structured model of a single .feature file
+type Feature struct {
+	Path        string      `json:"path"`
+	Name        string      `json:"name"`
+	Keyword     string      `json:"keyword"`
+	Language    string      `json:"language"`
+	Description string      `json:"description,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
+	Line        int         `json:"line"`
+	Background  *Background `json:"background,omitempty"`
+	Scenarios   []Scenario  `json:"scenarios,omitempty"`
+	Rules       []Rule      `json:"rules,omitempty"`
+}
+
+// Rule groups scenarios under a Rule: block, optionally with its own Background
+type Rule struct {
+	Name        string      `json:"name"`
+	Keyword     string      `json:"keyword"`
+	Description string      `json:"description,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
+	Line        int         `json:"line"`
+	Background  *Background `json:"background,omitempty"`
+	Scenarios   []Scenario  `json:"scenarios,omitempty"`
+}
+
+// Background holds the steps shared by every scenario of a feature or rule
+type Background struct {
+	Name    string `json:"name,omitempty"`
+	Keyword string `json:"keyword"`
+	Line    int    `json:"line"`
+	Steps   []Step `json:"steps"`
+}
+
+// Scenario is a Scenario or Scenario Outline; outlines carry their Examples tables
+type Scenario struct {
+	Name        string     `json:"name"`
+	Keyword     string     `json:"keyword"`
+	Description string     `json:"description,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Line        int        `json:"line"`
+	Steps       []Step     `json:"steps"`
+	Examples    []Examples `json:"examples,omitempty"`
+}
+
+// Step is a single Given/When/Then/And/But line including its argument
+type Step struct {
+	Keyword   string     `json:"keyword"`
+	Kind      StepKind   `json:"kind"`
+	Text      string     `json:"text"`
+	Line      int        `json:"line"`
+	DocString *DocString `json:"doc_string,omitempty"`
+	DataTable [][]string `json:"data_table,omitempty"`
+}
+
+// DocString is the """ block attached to a step
+type DocString struct {
+	MediaType string `json:"media_type,omitempty"`
+	Content   string `json:"content"`
+}
+
+// Examples is one Examples: table of a Scenario Outline
+type Examples struct {
+	Name     string        `json:"name,omitempty"`
+	Tags     []string      `json:"tags,omitempty"`
+	Line     int           `json:"line"`
+	Header   []string      `json:"header"`
+	Rows     [][]string    `json:"rows"`
+	Expanded []ExpandedRow `json:"expanded,omitempty"`
+}
+
+// ExpandedRow is one Examples row compiled by the Gherkin pickle compiler into concrete steps
+type ExpandedRow struct {
+	Name  string `json:"name"`
+	Line  int    `json:"line"`
+	Steps []Step `json:"steps"`
+}
+
+// IsOutline reports whether the scenario is a Scenario Outline
+func (s Scenario) IsOutline() bool {
+	return len(s.Examples) > 0
+}
+
+// AllScenarios returns the scenarios of the feature followed by those nested in rules
+func (f Feature) AllScenarios() []Scenario {
+	scenarios := append([]Scenario{}, f.Scenarios...)
+	for _, rule := range f.Rules {
+		scenarios = append(scenarios, rule.Scenarios...)
+	}
+	return scenarios
+}
+
+// ParseFeature parses Gherkin source into the structured model
+func ParseFeature(r io.Reader, path string) (*Feature, error) {
+	uuid := &messages.UUID{}
+	doc, err := gherkin.ParseGherkinDocument(r, uuid.NewId)
 	if err != nil {
 		return nil, err
 	}
 
-	var tests []Test
+	feature := &Feature{Path: path}
+	if doc.Feature == nil {
+		return feature, nil // A file with only comments or whitespace has no feature
+	}
+
+	// Compile pickles so outline rows can be expanded with their placeholders substituted
+	pickles := make(map[string]*messages.Pickle)
+	for _, pickle := range gherkin.Pickles(*doc, path, uuid.NewId) {
+		if len(pickle.AstNodeIds) > 1 {
+			pickles[pickle.AstNodeIds[1]] = pickle // Keyed by the Examples row id
+		}
+	}
+
+	f := doc.Feature
+	feature.Name = f.Name
+	feature.Keyword = f.Keyword
+	feature.Language = f.Language
+	feature.Description = strings.TrimSpace(f.Description)
+	feature.Tags = convertTags(f.Tags)
+	feature.Line = line(f.Location)
+
+	for _, child := range f.Children {
+		switch {
+		case child.Background != nil:
+			feature.Background = convertBackground(child.Background)
+		case child.Scenario != nil:
+			feature.Scenarios = append(feature.Scenarios, convertScenario(child.Scenario, pickles))
+		case child.Rule != nil:
+			feature.Rules = append(feature.Rules, convertRule(child.Rule, pickles))
+		}
+	}
+	return feature, nil
+}
+
+// ParseFeatures parses every feature file found below the specified directory.
+// Unchanged files are served from DefaultCache. Unreadable or malformed files are
+// skipped and reported as diagnostics, as are unreadable subdirectories; only a
+// failure to read the directory itself is returned as an error.
+func ParseFeatures(path string, opts WalkOptions) ([]Feature, []Diagnostic, error) {
+	files, walkDiagnostics, err := FindFeatureFiles(path, opts)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	features := []Feature{}
+	diagnostics := append([]Diagnostic{}, walkDiagnostics...)
 	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".feature") {
-			content, _ := os.ReadFile(path + "/" + file.Name())
-			re := regexp.MustCompile(`(?m)^\s*(Given|When|Then)\s+(.*)`)
-			matches := re.FindAllStringSubmatch(string(content), -1)
-
-			var steps []string
-			for _, match := range matches {
-				steps = append(steps, match[2])
+		// Report paths relative to the scanned directory
+		feature, found := DefaultCache.Load(filepath.Join(path, filepath.FromSlash(file)), file)
+		diagnostics = append(diagnostics, found...)
+		if feature != nil {
+			features = append(features, *feature)
+		}
+	}
+	DefaultCache.Prune(path, files)
+	return features, diagnostics, nil
+}
+
+// Parse feature files in the specified directory
+func ParseFeatureFiles(path string, opts WalkOptions) ([]Test, []Diagnostic, error) {
+	features, diagnostics, err := ParseFeatures(path, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return BuildTests(features, TestOptions{Granularity: GranularityFeature}), diagnostics, nil
+}
+
+func convertRule(r *messages.Rule, pickles map[string]*messages.Pickle) Rule {
+	rule := Rule{
+		Name:        r.Name,
+		Keyword:     r.Keyword,
+		Description: strings.TrimSpace(r.Description),
+		Tags:        convertTags(r.Tags),
+		Line:        line(r.Location),
+	}
+	for _, child := range r.Children {
+		switch {
+		case child.Background != nil:
+			rule.Background = convertBackground(child.Background)
+		case child.Scenario != nil:
+			rule.Scenarios = append(rule.Scenarios, convertScenario(child.Scenario, pickles))
+		}
+	}
+	return rule
+}
+
+func convertBackground(b *messages.Background) *Background {
+	return &Background{
+		Name:    b.Name,
+		Keyword: b.Keyword,
+		Line:    line(b.Location),
+		Steps:   convertSteps(b.Steps),
+	}
+}
+
+func convertScenario(s *messages.Scenario, pickles map[string]*messages.Pickle) Scenario {
+	scenario := Scenario{
+		Name:        s.Name,
+		Keyword:     s.Keyword,
+		Description: strings.TrimSpace(s.Description),
+		Tags:        convertTags(s.Tags),
+		Line:        line(s.Location),
+		Steps:       convertSteps(s.Steps),
+	}
+	for _, e := range s.Examples {
+		examples := Examples{
+			Name: e.Name,
+			Tags: convertTags(e.Tags),
+			Line: line(e.Location),
+		}
+		if e.TableHeader != nil {
+			examples.Header = convertRow(e.TableHeader)
+		}
+		for _, row := range e.TableBody {
+			examples.Rows = append(examples.Rows, convertRow(row))
+			if pickle, found := pickles[row.Id]; found {
+				examples.Expanded = append(examples.Expanded, expandRow(s, scenario.Steps, row, pickle))
 			}
-			tests = append(tests, Test{Name: file.Name(), Steps: steps})
 		}
+		scenario.Examples = append(scenario.Examples, examples)
+	}
+	return scenario
+}
+
+// Build the concrete steps of one outline row, leaving out the Background steps the pickle also carries
+func expandRow(s *messages.Scenario, converted []Step, row *messages.TableRow, pickle *messages.Pickle) ExpandedRow {
+	sources := make(map[string]Step, len(s.Steps))
+	for i, step := range s.Steps {
+		sources[step.Id] = converted[i]
+	}
+
+	expanded := ExpandedRow{Name: pickle.Name, Line: line(row.Location), Steps: []Step{}}
+	for _, ps := range pickle.Steps {
+		if len(ps.AstNodeIds) == 0 {
+			continue
+		}
+		source, found := sources[ps.AstNodeIds[0]]
+		if !found {
+			continue
+		}
+		step := Step{Keyword: source.Keyword, Kind: source.Kind, Text: ps.Text, Line: source.Line}
+		if ps.Argument != nil && ps.Argument.DocString != nil {
+			step.DocString = &DocString{MediaType: ps.Argument.DocString.MediaType, Content: ps.Argument.DocString.Content}
+		}
+		if ps.Argument != nil && ps.Argument.DataTable != nil {
+			for _, r := range ps.Argument.DataTable.Rows {
+				cells := make([]string, 0, len(r.Cells))
+				for _, cell := range r.Cells {
+					cells = append(cells, cell.Value)
+				}
+				step.DataTable = append(step.DataTable, cells)
+			}
+		}
+		expanded.Steps = append(expanded.Steps, step)
+	}
+	return expanded
+}
+
+func convertSteps(steps []*messages.Step) []Step {
+	converted := make([]Step, 0, len(steps))
+	var previous StepKind
+	for _, s := range steps {
+		step := Step{
+			Keyword: strings.TrimSpace(s.Keyword),
+			Kind:    stepKind(s.KeywordType, previous),
+			Text:    s.Text,
+			Line:    line(s.Location),
+		}
+		previous = step.Kind
+		if s.DocString != nil {
+			step.DocString = &DocString{MediaType: s.DocString.MediaType, Content: s.DocString.Content}
+		}
+		if s.DataTable != nil {
+			for _, row := range s.DataTable.Rows {
+				step.DataTable = append(step.DataTable, convertRow(row))
+			}
+		}
+		converted = append(converted, step)
+	}
+	return converted
+}
+
+func convertRow(row *messages.TableRow) []string {
+	cells := make([]string, 0, len(row.Cells))
+	for _, cell := range row.Cells {
+		cells = append(cells, cell.Value)
+	}
+	return cells
+}
+
+func convertTags(tags []*messages.Tag) []string {
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func line(location *messages.Location) int {
+	if location == nil {
+		return 0
 	}
-	return tests, nil
+	return int(location.Line)
 }
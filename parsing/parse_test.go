@@ -0,0 +1,228 @@
+package parsing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleFeature = `@billing
+Feature: Payments
+  Background:
+    Given I am logged in as "admin"
+    And I have a wallet
+
+  Scenario: Pay an invoice
+    When I pay the invoice
+      """
+      invoice body
+      """
+    Then the invoice is paid
+    But no email is sent
+
+  Rule: Refunds
+    Background:
+      Given a paid invoice exists
+
+    Scenario Outline: Refund an amount
+      When I refund <amount>
+        | reason | duplicate |
+      Then the balance is <balance>
+
+      Examples:
+        | amount | balance |
+        | 10     | 90      |
+        | 20     | 80      |
+`
+
+// Helper function to write a feature file into a temporary directory
+func writeFeature(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Error writing feature file: %v", err)
+	}
+}
+
+func TestParseFeature(t *testing.T) {
+	feature, err := ParseFeature(strings.NewReader(sampleFeature), "payments.feature")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if feature.Name != "Payments" || feature.Language != "en" {
+		t.Errorf("Unexpected feature header: %q (%s)", feature.Name, feature.Language)
+	}
+	if feature.Background == nil || len(feature.Background.Steps) != 2 {
+		t.Fatalf("Expected a background with 2 steps, got %+v", feature.Background)
+	}
+	if feature.Background.Steps[1].Keyword != "And" {
+		t.Errorf("Expected And keyword to be kept, got %q", feature.Background.Steps[1].Keyword)
+	}
+
+	scenario := feature.Scenarios[0]
+	if len(scenario.Steps) != 3 {
+		t.Fatalf("Expected 3 scenario steps, got %d", len(scenario.Steps))
+	}
+	if scenario.Steps[0].DocString == nil || scenario.Steps[0].DocString.Content != "invoice body" {
+		t.Errorf("Expected doc string to be parsed, got %+v", scenario.Steps[0].DocString)
+	}
+
+	if len(feature.Rules) != 1 || feature.Rules[0].Background == nil {
+		t.Fatalf("Expected one rule with a background, got %+v", feature.Rules)
+	}
+	outline := feature.Rules[0].Scenarios[0]
+	if !outline.IsOutline() || len(outline.Examples[0].Rows) != 2 {
+		t.Errorf("Expected an outline with 2 example rows, got %+v", outline.Examples)
+	}
+	if len(outline.Steps[0].DataTable) != 1 || outline.Steps[0].DataTable[0][1] != "duplicate" {
+		t.Errorf("Expected data table to be parsed, got %v", outline.Steps[0].DataTable)
+	}
+}
+
+func TestParseFeatureFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFeature(t, dir, "payments.feature", sampleFeature)
+	writeFeature(t, dir, "notes.txt", "Given this is not a feature")
+
+	tests, diagnostics, err := ParseFeatureFiles(dir, WalkOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", diagnostics)
+	}
+	if len(tests) != 1 {
+		t.Fatalf("Expected 1 test, got %d", len(tests))
+	}
+
+	// Background, And/But and rule steps must all be present
+	expected := 2 + 3 + 1 + 2
+	if len(tests[0].Steps) != expected {
+		t.Errorf("Expected %d steps, got %d: %v", expected, len(tests[0].Steps), tests[0].Steps)
+	}
+}
+
+func TestBuildTestsGranularity(t *testing.T) {
+	feature, err := ParseFeature(strings.NewReader(sampleFeature), "payments.feature")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	features := []Feature{*feature}
+
+	testCases := []struct {
+		granularity Granularity
+		count       int
+	}{
+		{GranularityFeature, 1},
+		{GranularityRule, 2},
+		{GranularityScenario, 2},
+	}
+	for _, tc := range testCases {
+		tests := BuildTests(features, TestOptions{Granularity: tc.granularity})
+		if len(tests) != tc.count {
+			t.Errorf("Expected %d tests at %s granularity, got %d", tc.count, tc.granularity, len(tests))
+		}
+	}
+
+	scenarios := BuildTests(features, TestOptions{Granularity: GranularityScenario})
+	refund := scenarios[1]
+	if refund.Ref.File != "payments.feature" || refund.Ref.Scenario != "Refund an amount" || refund.Ref.Rule != "Refunds" {
+		t.Errorf("Unexpected scenario reference: %+v", refund.Ref)
+	}
+	if refund.Ref.Line != 19 {
+		t.Errorf("Expected scenario line 19, got %d", refund.Ref.Line)
+	}
+	// Feature and rule backgrounds run before the outline's own steps
+	if len(refund.Steps) != 5 || refund.Steps[2] != "a paid invoice exists" {
+		t.Errorf("Unexpected scenario steps: %v", refund.Steps)
+	}
+}
+
+func TestParseGranularity(t *testing.T) {
+	if g, err := ParseGranularity(""); err != nil || g != GranularityFeature {
+		t.Errorf("Expected default feature granularity, got %q (%v)", g, err)
+	}
+	if _, err := ParseGranularity("step"); err == nil {
+		t.Error("Expected an error for an unknown granularity")
+	}
+}
+
+func TestBuildTestsExpandOutlines(t *testing.T) {
+	feature, err := ParseFeature(strings.NewReader(sampleFeature), "payments.feature")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	features := []Feature{*feature}
+
+	tests := BuildTests(features, TestOptions{Granularity: GranularityScenario, ExpandOutlines: true})
+	if len(tests) != 3 {
+		t.Fatalf("Expected 1 scenario and 2 expanded rows, got %d", len(tests))
+	}
+
+	second := tests[2]
+	if second.Ref.Example == nil || second.Ref.Example.Row != 2 || second.Ref.Example.Line != 27 {
+		t.Fatalf("Unexpected example reference: %+v", second.Ref.Example)
+	}
+	if second.Ref.Example.Values["amount"] != "20" {
+		t.Errorf("Expected amount 20, got %v", second.Ref.Example.Values)
+	}
+	if last := second.Steps[len(second.Steps)-1]; last != "the balance is 80" {
+		t.Errorf("Expected substituted step, got %q", last)
+	}
+
+	// Rows that keep their placeholders are still one test each, told apart by their example row
+	kept := BuildTests(features, TestOptions{Granularity: GranularityScenario, ExpandOutlines: true, KeepPlaceholders: true})
+	if len(kept) != len(tests) {
+		t.Fatalf("Expected %d tests, got %d", len(tests), len(kept))
+	}
+	if last := kept[2].Steps[len(kept[2].Steps)-1]; last != "the balance is <balance>" {
+		t.Errorf("Expected placeholder to be kept, got %q", last)
+	}
+	if kept[1].Name == kept[2].Name {
+		t.Errorf("Expected expanded tests to have distinct names, got %q", kept[1].Name)
+	}
+	if example := kept[2].Ref.Example; example == nil || example.Row != 2 || example.Values["amount"] != "20" {
+		t.Errorf("Expected the second example row, got %+v", example)
+	}
+}
+
+func TestParseFeatureDialect(t *testing.T) {
+	spanish := `# language: es
+Característica: Pagos
+  Escenario: Pagar una factura
+    Dado que tengo una factura
+    Y tengo saldo
+    Cuando pago la factura
+    Entonces la factura está pagada`
+	english := `Feature: Payments
+  Scenario: Pay an invoice
+    Given que tengo una factura
+    And tengo saldo
+    When pago la factura
+    Then la factura está pagada`
+
+	es, err := ParseFeature(strings.NewReader(spanish), "pagos.feature")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	en, err := ParseFeature(strings.NewReader(english), "payments.feature")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	opts := TestOptions{Granularity: GranularityScenario, StepKinds: true}
+	esSteps := BuildTests([]Feature{*es}, opts)[0].Steps
+	enSteps := BuildTests([]Feature{*en}, opts)[0].Steps
+	if !reflect.DeepEqual(esSteps, enSteps) {
+		t.Errorf("Expected language-neutral steps to match:\n%v\n%v", esSteps, enSteps)
+	}
+	if esSteps[1] != "context: tengo saldo" || esSteps[3] != "outcome: la factura está pagada" {
+		t.Errorf("Unexpected step kinds: %v", esSteps)
+	}
+}
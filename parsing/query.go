@@ -0,0 +1,60 @@
+package parsing
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// WalkOptionsFromQuery reads include, exclude and follow_symlinks from request parameters.
+// Patterns may be repeated or given as a comma separated list.
+func WalkOptionsFromQuery(query url.Values) WalkOptions {
+	return WalkOptions{
+		Include:        listParam(query, "include"),
+		Exclude:        listParam(query, "exclude"),
+		FollowSymlinks: query.Get("follow_symlinks") == "true",
+	}
+}
+
+// TestOptionsFromQuery reads granularity, expand_outlines, placeholders, step_kinds and normalize from request parameters
+func TestOptionsFromQuery(query url.Values) (TestOptions, error) {
+	granularity, err := ParseGranularity(query.Get("granularity"))
+	if err != nil {
+		return TestOptions{}, err
+	}
+
+	opts := TestOptions{
+		Granularity:    granularity,
+		ExpandOutlines: query.Get("expand_outlines") == "true",
+		StepKinds:      query.Get("step_kinds") == "true",
+	}
+	normalizer, err := ParseNormalizer(query.Get("normalize"))
+	if err != nil {
+		return TestOptions{}, err
+	}
+	opts.Normalize = normalizer
+
+	switch query.Get("placeholders") {
+	case "", "substitute":
+	case "keep":
+		if !opts.ExpandOutlines {
+			return TestOptions{}, fmt.Errorf("placeholders=keep requires expand_outlines=true")
+		}
+		opts.KeepPlaceholders = true
+	default:
+		return TestOptions{}, fmt.Errorf("unknown placeholders mode %q (expected substitute or keep)", query.Get("placeholders"))
+	}
+	return opts, nil
+}
+
+func listParam(query url.Values, key string) []string {
+	var values []string
+	for _, value := range query[key] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
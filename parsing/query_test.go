@@ -0,0 +1,31 @@
+package parsing
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestTestOptionsFromQuery(t *testing.T) {
+	tests := []struct {
+		query   url.Values
+		keep    bool
+		invalid bool
+	}{
+		{url.Values{}, false, false},
+		{url.Values{"expand_outlines": {"true"}, "placeholders": {"substitute"}}, false, false},
+		{url.Values{"expand_outlines": {"true"}, "placeholders": {"keep"}}, true, false},
+		// Without expansion there are no rows whose placeholders could be kept
+		{url.Values{"placeholders": {"keep"}}, false, true},
+		{url.Values{"expand_outlines": {"true"}, "placeholders": {"drop"}}, false, true},
+	}
+	for _, test := range tests {
+		opts, err := TestOptionsFromQuery(test.query)
+		if (err != nil) != test.invalid {
+			t.Errorf("Expected error %v for %v, got %v", test.invalid, test.query, err)
+			continue
+		}
+		if opts.KeepPlaceholders != test.keep {
+			t.Errorf("Expected KeepPlaceholders %v for %v, got %v", test.keep, test.query, opts.KeepPlaceholders)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package parsing
+
+import "fmt"
+
+// Granularity controls which unit of a feature file becomes a single Test
+type Granularity string
+
+const (
+	GranularityFeature  Granularity = "feature"
+	GranularityRule     Granularity = "rule"
+	GranularityScenario Granularity = "scenario"
+)
+
+// TestOptions controls how parsed features are flattened into comparable tests
+type TestOptions struct {
+	Granularity Granularity
+	// ExpandOutlines turns every Examples row of a Scenario Outline into its own step list
+	ExpandOutlines bool
+	// KeepPlaceholders leaves <placeholder> tokens in expanded steps instead of substituting row values
+	KeepPlaceholders bool
+	// StepKinds prefixes every step with its language-neutral kind, e.g. "outcome: I see the dashboard"
+	StepKinds bool
+	// Normalize, when set, also renders every step as a template into Test.Templates
+	Normalize *Normalizer
+}
+
+// TestRef identifies where a Test came from in the scanned directory
+type TestRef struct {
+	File     string      `json:"file"`
+	Rule     string      `json:"rule,omitempty"`
+	Scenario string      `json:"scenario,omitempty"`
+	Line     int         `json:"line,omitempty"`
+	Example  *ExampleRef `json:"example,omitempty"`
+	Suite    string      `json:"suite,omitempty"` // "a" or "b" when two directories are compared
+}
+
+// ExampleRef identifies the Examples row an expanded outline test was built from
+type ExampleRef struct {
+	Examples string            `json:"examples,omitempty"`
+	Row      int               `json:"row"`
+	Line     int               `json:"line"`
+	Values   map[string]string `json:"values"`
+}
+
+// ParseGranularity validates a granularity name, defaulting to feature level
+func ParseGranularity(value string) (Granularity, error) {
+	switch Granularity(value) {
+	case "", GranularityFeature:
+		return GranularityFeature, nil
+	case GranularityRule, GranularityScenario:
+		return Granularity(value), nil
+	}
+	return "", fmt.Errorf("unknown granularity %q (expected feature, rule or scenario)", value)
+}
+
+// BuildTests flattens parsed features into comparable tests
+func BuildTests(features []Feature, opts TestOptions) []Test {
+	var tests []Test
+	for _, feature := range features {
+		switch opts.Granularity {
+		case GranularityScenario:
+			tests = append(tests, opts.scenarioTests(feature)...)
+		case GranularityRule:
+			tests = append(tests, opts.ruleTests(feature)...)
+		default:
+			steps := backgroundSteps(feature.Background)
+			steps = opts.appendScenarios(steps, feature.Scenarios)
+			for _, rule := range feature.Rules {
+				steps = append(steps, backgroundSteps(rule.Background)...)
+				steps = opts.appendScenarios(steps, rule.Scenarios)
+			}
+			tests = append(tests, opts.newTest(feature.Path, TestRef{File: feature.Path, Line: feature.Line}, steps))
+		}
+	}
+	return tests
+}
+
+// variant is one runnable form of a scenario: the scenario itself or a single outline row
+type variant struct {
+	name    string
+	steps   []Step
+	example *ExampleRef
+}
+
+// Expand a scenario into the step lists it contributes under these options
+func (o TestOptions) variants(scenario Scenario) []variant {
+	if !o.ExpandOutlines || !scenario.IsOutline() {
+		return []variant{{name: scenario.Name, steps: scenario.Steps}}
+	}
+
+	var variants []variant
+	for _, examples := range scenario.Examples {
+		for i, row := range examples.Expanded {
+			ref := &ExampleRef{Examples: examples.Name, Row: i + 1, Line: row.Line, Values: map[string]string{}}
+			if i < len(examples.Rows) {
+				for j, key := range examples.Header {
+					if j < len(examples.Rows[i]) {
+						ref.Values[key] = examples.Rows[i][j]
+					}
+				}
+			}
+			v := variant{name: row.Name, steps: row.Steps, example: ref}
+			if o.KeepPlaceholders {
+				v.name, v.steps = scenario.Name, scenario.Steps
+			}
+			variants = append(variants, v)
+		}
+	}
+	return variants
+}
+
+func (o TestOptions) appendScenarios(steps []Step, scenarios []Scenario) []Step {
+	for _, scenario := range scenarios {
+		for _, v := range o.variants(scenario) {
+			steps = append(steps, v.steps...)
+		}
+	}
+	return steps
+}
+
+// One test per scenario (or outline row), each carrying the Background steps that run before it
+func (o TestOptions) scenarioTests(feature Feature) []Test {
+	var tests []Test
+	featureBackground := backgroundSteps(feature.Background)
+
+	add := func(rule string, background []Step, scenarios []Scenario) {
+		for _, scenario := range scenarios {
+			for _, v := range o.variants(scenario) {
+				steps := append(append([]Step{}, background...), v.steps...)
+				ref := TestRef{File: feature.Path, Rule: rule, Scenario: v.name, Line: scenario.Line, Example: v.example}
+				tests = append(tests, o.newTest(ref.String(), ref, steps))
+			}
+		}
+	}
+
+	add("", featureBackground, feature.Scenarios)
+	for _, rule := range feature.Rules {
+		background := append(append([]Step{}, featureBackground...), backgroundSteps(rule.Background)...)
+		add(rule.Name, background, rule.Scenarios)
+	}
+	return tests
+}
+
+// One test per rule; scenarios outside any rule are grouped under the feature itself
+func (o TestOptions) ruleTests(feature Feature) []Test {
+	var tests []Test
+	featureBackground := backgroundSteps(feature.Background)
+
+	if len(feature.Scenarios) > 0 {
+		steps := o.appendScenarios(append([]Step{}, featureBackground...), feature.Scenarios)
+		ref := TestRef{File: feature.Path, Line: feature.Line}
+		tests = append(tests, o.newTest(fmt.Sprintf("%s:%d %s", feature.Path, feature.Line, feature.Name), ref, steps))
+	}
+
+	for _, rule := range feature.Rules {
+		steps := append(append([]Step{}, featureBackground...), backgroundSteps(rule.Background)...)
+		steps = o.appendScenarios(steps, rule.Scenarios)
+		ref := TestRef{File: feature.Path, Rule: rule.Name, Line: rule.Line}
+		tests = append(tests, o.newTest(ref.String(), ref, steps))
+	}
+	return tests
+}
+
+func backgroundSteps(background *Background) []Step {
+	if background == nil {
+		return []Step{}
+	}
+	return background.Steps
+}
+
+// Render steps to the strings the similarity metrics compare, plus their templates when normalising
+func (o TestOptions) newTest(name string, ref TestRef, steps []Step) Test {
+	test := Test{Name: name, Ref: ref, Steps: make([]string, 0, len(steps)), Source: steps}
+	if o.Normalize != nil {
+		test.Templates = make([]string, 0, len(steps))
+	}
+	for _, step := range steps {
+		prefix := ""
+		if o.StepKinds {
+			prefix = string(step.Kind) + ": "
+		}
+		test.Steps = append(test.Steps, prefix+step.Text)
+		if o.Normalize != nil {
+			test.Templates = append(test.Templates, prefix+o.Normalize.Template(step))
+		}
+	}
+	return test
+}
+
+// String renders the reference as "file:line name" for use as a unique test name
+func (r TestRef) String() string {
+	name := r.Scenario
+	if name == "" {
+		name = r.Rule
+	}
+	if r.Line == 0 {
+		return r.File
+	}
+	if r.Example != nil {
+		return fmt.Sprintf("%s:%d %s (example at line %d)", r.File, r.Line, name, r.Example.Line)
+	}
+	return fmt.Sprintf("%s:%d %s", r.File, r.Line, name)
+}
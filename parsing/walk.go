@@ -0,0 +1,174 @@
+package parsing
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultInclude matches every feature file at any depth
+const DefaultInclude = "**/*.feature"
+
+// WalkOptions controls how feature files are discovered below a root directory.
+// Patterns are matched against slash-separated paths relative to the root and
+// support `**` for any number of directories.
+type WalkOptions struct {
+	Include        []string `json:"include,omitempty"`
+	Exclude        []string `json:"exclude,omitempty"`
+	FollowSymlinks bool     `json:"follow_symlinks,omitempty"`
+}
+
+// Reads a directory during the walk; replaced in tests to simulate unreadable directories
+var readDir = os.ReadDir
+
+// FindFeatureFiles finds the feature files below root, every one of them unless opts.Include narrows them down
+func FindFeatureFiles(root string, opts WalkOptions) ([]string, []Diagnostic, error) {
+	if len(opts.Include) == 0 {
+		opts.Include = []string{DefaultInclude}
+	}
+	return FindFiles(root, opts)
+}
+
+// FindFiles walks root recursively and returns the relative paths of the files matching opts.Include in sorted order.
+// Subdirectories that cannot be read are skipped and reported as diagnostics; only a root that cannot be read is an error.
+func FindFiles(root string, opts WalkOptions) ([]string, []Diagnostic, error) {
+
+	// Resolve the root so symlink cycles can be detected against real paths
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(realRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil, &os.PathError{Op: "walk", Path: root, Err: os.ErrInvalid}
+	}
+
+	w := walker{root: root, include: opts.Include, exclude: opts.Exclude, follow: opts.FollowSymlinks, visited: map[string]bool{realRoot: true}}
+	if err := w.walk(""); err != nil {
+		return nil, nil, err
+	}
+	// Linked directories are walked once every real directory is known, so a link into the root is skipped rather than its target
+	for len(w.links) > 0 {
+		link := w.links[0]
+		w.links = w.links[1:]
+		if w.enter(link) {
+			if err := w.walk(link); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	sort.Strings(w.files)
+	return w.files, w.diagnostics, nil
+}
+
+type walker struct {
+	root    string
+	include []string
+	exclude []string
+	follow  bool
+	visited map[string]bool // Real paths of directories already walked
+	links   []string        // Symlinked directories still to walk
+	files   []string
+
+	diagnostics []Diagnostic // Subdirectories that could not be read
+}
+
+func (w *walker) walk(rel string) error {
+	entries, err := readDir(filepath.Join(w.root, filepath.FromSlash(rel)))
+	if err != nil {
+		if rel == "" {
+			return err
+		}
+		w.diagnostics = append(w.diagnostics, Diagnostic{File: rel, Severity: SeverityError, Message: "unreadable directory: " + err.Error()})
+		return nil
+	}
+
+	for _, entry := range entries {
+		entryRel := path.Join(rel, entry.Name())
+		if matchAny(w.exclude, entryRel) {
+			continue
+		}
+
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if !w.follow {
+				continue // Symlinks are only traversed when explicitly requested
+			}
+			target, err := os.Stat(filepath.Join(w.root, filepath.FromSlash(entryRel)))
+			if err != nil {
+				continue // Dangling link
+			}
+			if target.IsDir() {
+				w.links = append(w.links, entryRel)
+				continue
+			}
+		}
+
+		if isDir {
+			if w.follow && !w.enter(entryRel) {
+				continue
+			}
+			if err := w.walk(entryRel); err != nil {
+				return err
+			}
+			continue
+		}
+		if matchAny(w.include, entryRel) {
+			w.files = append(w.files, entryRel)
+		}
+	}
+	return nil
+}
+
+// Record the real path of a directory about to be walked; false when it cannot be resolved or was already walked,
+// e.g. through a symlink cycle or a second link to the same directory
+func (w *walker) enter(rel string) bool {
+	real, err := filepath.EvalSymlinks(filepath.Join(w.root, filepath.FromSlash(rel)))
+	if err != nil || w.visited[real] {
+		return false
+	}
+	w.visited[real] = true
+	return true
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if MatchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob reports whether a slash-separated path matches a glob pattern where
+// `**` matches zero or more whole path segments
+func MatchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try every possible number of segments for the double star
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,128 @@
+package parsing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"**/*.feature", "login.feature", true},
+		{"**/*.feature", "payments/refunds/full.feature", true},
+		{"**/*.feature", "payments/notes.txt", false},
+		{"**/vendor/**", "vendor", true},
+		{"**/vendor/**", "lib/vendor/x.feature", true},
+		{"payments/*.feature", "payments/refunds/full.feature", false},
+		{"payments/**/*.feature", "payments/full.feature", true},
+	}
+
+	for _, tc := range testCases {
+		if result := MatchGlob(tc.pattern, tc.name); result != tc.match {
+			t.Errorf("MatchGlob(%q, %q): expected %v, got %v", tc.pattern, tc.name, tc.match, result)
+		}
+	}
+}
+
+func TestFindFeatureFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFeature(t, dir, "login.feature", "Feature: Login")
+	writeFeature(t, dir, "payments/refunds/full.feature", "Feature: Refunds")
+	writeFeature(t, dir, "payments/wip/draft.feature", "Feature: Draft")
+	writeFeature(t, dir, "vendor/lib.feature", "Feature: Vendored")
+
+	files, _, err := FindFeatureFiles(dir, WalkOptions{Exclude: []string{"**/vendor/**", "**/wip/**"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []string{"login.feature", "payments/refunds/full.feature"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+
+	files, _, err = FindFeatureFiles(dir, WalkOptions{Include: []string{"payments/**/*.feature"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("Expected 2 payment features, got %v", files)
+	}
+}
+
+func TestFindFeatureFilesSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFeature(t, dir, "shared/common.feature", "Feature: Common")
+	if err := os.Symlink(filepath.Join(dir, "shared"), filepath.Join(dir, "linked")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	// A link back to the root must not cause an endless walk
+	if err := os.Symlink(dir, filepath.Join(dir, "shared", "loop")); err != nil {
+		t.Fatalf("Error creating symlink: %v", err)
+	}
+	outside := t.TempDir()
+	writeFeature(t, outside, "external.feature", "Feature: External")
+	if err := os.Symlink(outside, filepath.Join(dir, "vendor")); err != nil {
+		t.Fatalf("Error creating symlink: %v", err)
+	}
+
+	files, _, err := FindFeatureFiles(dir, WalkOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(files, []string{"shared/common.feature"}) {
+		t.Errorf("Expected symlinks to be skipped, got %v", files)
+	}
+
+	files, _, err = FindFeatureFiles(dir, WalkOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The link into the root is a second path to shared, so only the directory outside the root adds files
+	expected := []string{"shared/common.feature", "vendor/external.feature"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
+
+func TestFindFeatureFilesUnreadableDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFeature(t, dir, "login.feature", "Feature: Login")
+	writeFeature(t, dir, "locked/secret.feature", "Feature: Secret")
+	writeFeature(t, dir, "payments/refund.feature", "Feature: Refund")
+
+	defer func(original func(string) ([]os.DirEntry, error)) { readDir = original }(readDir)
+	readDir = func(name string) ([]os.DirEntry, error) {
+		if filepath.Base(name) == "locked" {
+			return nil, os.ErrPermission
+		}
+		return os.ReadDir(name)
+	}
+
+	// The rest of the tree is still walked
+	files, diagnostics, err := FindFeatureFiles(dir, WalkOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := []string{"login.feature", "payments/refund.feature"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].File != "locked" || diagnostics[0].Severity != SeverityError {
+		t.Errorf("Expected a diagnostic for the locked directory, got %+v", diagnostics)
+	}
+
+	features, diagnostics, err := ParseFeatures(dir, WalkOptions{})
+	if err != nil || len(features) != 2 || len(diagnostics) != 1 {
+		t.Errorf("Expected 2 features and 1 diagnostic, got %d, %+v (%v)", len(features), diagnostics, err)
+	}
+
+	// An unreadable root still fails the walk
+	readDir = func(string) ([]os.DirEntry, error) { return nil, os.ErrPermission }
+	if _, _, err := FindFeatureFiles(dir, WalkOptions{}); err == nil {
+		t.Errorf("Expected an error for an unreadable root")
+	}
+}
@@ -13,10 +13,12 @@ document.getElementById('fetchMergedJourneys').addEventListener('click', functio
 });
 
 function fetchSimilarityReports(directory) {
-    let url = '/api/similarity-reports';
+    // Only the closest neighbours of each test are drawn, so keep the payload small
+    const params = new URLSearchParams({ top_k: 5, min_similarity: 0.2 });
     if (directory) {
-        url += `?directory=${encodeURIComponent(directory)}`;
+        params.set('directory', directory);
     }
+    const url = `/api/similarity-reports?${params}`;
 
     fetch(url)
         .then(response => response.json())
@@ -60,11 +62,11 @@ function renderForceDirectedGraph(data) {
     const nodes = [];
     const links = [];
 
-    // Extract nodes and create links for LCS, Cosine, Jaccard
-    const metrics = ['lcs_report', 'cosine_report', 'jaccard_report'];
+    // Extract nodes and create links for every metric in the response
+    const metrics = Object.keys(data.reports);
     
     metrics.forEach(metric => {
-        data[metric].comparisons.forEach(comparison => {
+        data.reports[metric].comparisons.forEach(comparison => {
             // Add nodes if they don't already exist
             const testA = { id: comparison.testA };
             const testB = { id: comparison.testB };
@@ -4,6 +4,10 @@ document.getElementById('fetchReports').addEventListener('click', function() {
 });
 
 function fetchSimilarityReports(chartType) {
+    if (chartType === 'dendrogram') {
+        fetchSimilarityClusters();
+        return;
+    }
     const url = '/api/similarity-reports'; // Adjust if needed
 
     fetch(url)
@@ -25,10 +29,10 @@ function fetchSimilarityReports(chartType) {
 
 function renderBarChart(data) {
     // Define the metrics we will visualize
-    const metrics = ['lcs_report', 'cosine_report', 'jaccard_report'];
+    const metrics = Object.keys(data.reports);
 
     // Prepare the reports for each metric
-    const reports = [data.lcs_report, data.cosine_report, data.jaccard_report];
+    const reports = metrics.map(metric => data.reports[metric]);
 
     // Set the dimensions of the SVG for the bar chart
     const width = 800;
@@ -107,7 +111,7 @@ function renderLegend(metrics) {
 
 // Function to render heatmap
 function renderHeatmap(data) {
-    const reports = [data.lcs_report, data.cosine_report, data.jaccard_report];
+    const reports = Object.values(data.reports);
 
     // Prepare data for heatmap
     const heatmapData = [];
@@ -165,7 +169,7 @@ function renderHeatmap(data) {
 
 // Function to render radar chart
 function renderRadarChart(data) {
-const reports = [data.lcs_report, data.cosine_report, data.jaccard_report];
+const reports = Object.values(data.reports);
 
 // Prepare nodes based on reports
 const nodes = reports.map(report => ({
@@ -226,3 +230,59 @@ nodes[0].values.forEach((d, i) => {
         .text(d.name);
 });
 }
+
+// Fetch the duplicate clusters and draw their dendrogram
+function fetchSimilarityClusters() {
+    fetch('/api/similarity-reports/clusters')
+        .then(response => response.json())
+        .then(data => {
+            d3.select("#reportContainer").selectAll("*").remove();
+            d3.select("#legendContainer").selectAll("*").remove();
+            renderDendrogram(data);
+        })
+        .catch(error => console.error('Error fetching clusters:', error));
+}
+
+// Function to render the clustering dendrogram, merges below the cut threshold are greyed out
+function renderDendrogram(data) {
+    if (!data.dendrogram) return;
+
+    const root = d3.hierarchy(data.dendrogram);
+    const leaves = root.leaves().length;
+    const margin = { top: 20, right: 300, bottom: 20, left: 20 };
+    const width = 600;
+    const height = Math.max(200, leaves * 18);
+
+    const svg = d3.select("#reportContainer").append("svg")
+        .attr("width", width + margin.left + margin.right)
+        .attr("height", height + margin.top + margin.bottom)
+        .append("g")
+        .attr("transform", `translate(${margin.left},${margin.top})`);
+
+    // Nodes are placed by the similarity they merged at, from 0 on the left to 1 on the right
+    d3.cluster().size([height, width])(root);
+    const x = d3.scaleLinear().domain([0, 1]).range([0, width]);
+    root.each(d => { d.y = x(d.data.similarity); });
+
+    svg.selectAll(".link")
+        .data(root.links())
+        .enter().append("path")
+        .attr("class", "link")
+        .attr("fill", "none")
+        .attr("stroke", d => d.source.data.similarity >= data.threshold ? "steelblue" : "#ccc")
+        .attr("d", d => `M${d.source.y},${d.source.x}V${d.target.x}H${d.target.y}`);
+
+    svg.selectAll(".leaf")
+        .data(root.leaves())
+        .enter().append("text")
+        .attr("class", "leaf")
+        .attr("x", d => d.y + 4)
+        .attr("y", d => d.x)
+        .attr("dy", "0.32em")
+        .style("font-size", "12px")
+        .text(d => d.data.test);
+
+    svg.append("g")
+        .attr("transform", `translate(0,${height})`)
+        .call(d3.axisBottom(x));
+}
@@ -0,0 +1,129 @@
+package stepdefs
+
+import (
+	"encoding/json"
+	"go-similarity-reports/parsing"
+	"net/http"
+)
+
+// StepLocation is a feature step as written in a feature file
+type StepLocation struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Scenario string `json:"scenario,omitempty"`
+	Text     string `json:"text"`
+}
+
+// AmbiguousStep is a step matched by more than one definition pattern
+type AmbiguousStep struct {
+	Step        StepLocation `json:"step"`
+	Definitions []Definition `json:"definitions"`
+}
+
+// Report lists the gaps between the feature steps and the step definitions
+type Report struct {
+	OK          bool                 `json:"ok"` // False when any step is undefined or ambiguous
+	Undefined   []StepLocation       `json:"undefined"`
+	Unused      []Definition         `json:"unused"`
+	Ambiguous   []AmbiguousStep      `json:"ambiguous"`
+	Diagnostics []parsing.Diagnostic `json:"diagnostics"`
+}
+
+// BuildReport matches every step of the features against the definitions.
+// Outline steps are checked once per Examples row so <placeholders> are resolved first.
+func BuildReport(features []parsing.Feature, defs Definitions) Report {
+	report := Report{Undefined: []StepLocation{}, Unused: []Definition{}, Ambiguous: []AmbiguousStep{}}
+	used := make(map[*Definition]bool)
+	seen := make(map[StepLocation]bool) // Outline rows repeat the same step line
+
+	check := func(file, scenario string, steps []parsing.Step) {
+		for _, step := range steps {
+			location := StepLocation{File: file, Line: step.Line, Scenario: scenario, Text: step.Text}
+			if seen[location] {
+				continue
+			}
+			seen[location] = true
+
+			matches := defs.Match(step)
+			for _, match := range matches {
+				used[match] = true
+			}
+			switch {
+			case len(matches) == 0:
+				report.Undefined = append(report.Undefined, location)
+			case len(matches) > 1:
+				ambiguous := AmbiguousStep{Step: location}
+				for _, match := range matches {
+					ambiguous.Definitions = append(ambiguous.Definitions, *match)
+				}
+				report.Ambiguous = append(report.Ambiguous, ambiguous)
+			}
+		}
+	}
+	checkScenarios := func(file string, background *parsing.Background, scenarios []parsing.Scenario) {
+		if background != nil {
+			check(file, "", background.Steps)
+		}
+		for _, scenario := range scenarios {
+			if !scenario.IsOutline() {
+				check(file, scenario.Name, scenario.Steps)
+				continue
+			}
+			for _, examples := range scenario.Examples {
+				for _, row := range examples.Expanded {
+					check(file, scenario.Name, row.Steps)
+				}
+			}
+		}
+	}
+
+	for _, feature := range features {
+		checkScenarios(feature.Path, feature.Background, feature.Scenarios)
+		for _, rule := range feature.Rules {
+			checkScenarios(feature.Path, rule.Background, rule.Scenarios)
+		}
+	}
+
+	for i := range defs {
+		if !used[&defs[i]] {
+			report.Unused = append(report.Unused, defs[i])
+		}
+	}
+	report.OK = len(report.Undefined) == 0 && len(report.Ambiguous) == 0
+	return report
+}
+
+// Endpoint to list undefined steps, unused definitions and ambiguous steps
+func GetStepDefinitionReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dir := query.Get("directory")
+	if dir == "" {
+		dir = "./tdata" // Default path
+	}
+	source := query.Get("step_definitions")
+	if source == "" {
+		http.Error(w, "step_definitions is required", http.StatusBadRequest)
+		return
+	}
+
+	features, diagnostics, err := parsing.ParseFeatures(dir, parsing.WalkOptionsFromQuery(query))
+	if err != nil {
+		http.Error(w, "Error parsing tests: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defs, defDiagnostics, err := ScanDefinitions(source)
+	if err != nil {
+		http.Error(w, "Error scanning step definitions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := BuildReport(features, defs)
+	report.Diagnostics = append(diagnostics, defDiagnostics...)
+
+	// In strict mode a failing report is an error status so CI can gate on it
+	w.Header().Set("Content-Type", "application/json")
+	if query.Get("strict") == "true" && !report.OK {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(report)
+}
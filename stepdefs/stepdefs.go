@@ -0,0 +1,162 @@
+package stepdefs
+
+import (
+	"fmt"
+	"go-similarity-reports/parsing"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// Methods of godog's ScenarioContext that register a step definition
+var stepMethods = map[string]bool{"Step": true, "Given": true, "When": true, "Then": true}
+
+// Kind of step that the definitions of each keyword method match; ctx.Step matches any step.
+// And and But steps take the kind of the step before them.
+var methodKinds = map[string]parsing.StepKind{"Given": parsing.KindContext, "When": parsing.KindAction, "Then": parsing.KindOutcome}
+
+// Definition is a godog step definition registered with ctx.Step(`pattern`, fn)
+type Definition struct {
+	Pattern  string `json:"pattern"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Method   string `json:"method"`
+	Function string `json:"function,omitempty"`
+	regex    *regexp.Regexp
+}
+
+// Definitions is every step definition found in a source tree, in file order
+type Definitions []Definition
+
+// Unbound is the prefix used for steps that match no definition when binding
+const Unbound = "undefined: "
+
+// ScanDefinitions parses the Go files below root and collects their step definitions.
+// Files that fail to parse and patterns that fail to compile are reported as diagnostics.
+func ScanDefinitions(root string) (Definitions, []parsing.Diagnostic, error) {
+	files, walkDiagnostics, err := parsing.FindFiles(root, parsing.WalkOptions{
+		Include: []string{"**/*.go"},
+		Exclude: []string{"**/vendor/**", "**/.git/**"},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defs := Definitions{}
+	diagnostics := append([]parsing.Diagnostic{}, walkDiagnostics...)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		node, err := parser.ParseFile(fset, filepath.Join(root, filepath.FromSlash(file)), nil, 0)
+		if err != nil {
+			diagnostics = append(diagnostics, parsing.Diagnostic{File: file, Severity: parsing.SeverityError, Message: err.Error()})
+			continue
+		}
+
+		ast.Inspect(node, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) != 2 {
+				return true
+			}
+			selector, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || !stepMethods[selector.Sel.Name] {
+				return true
+			}
+			pattern, ok := patternLiteral(call.Args[0])
+			if !ok {
+				return true // Not a step registration with a constant pattern
+			}
+
+			position := fset.Position(call.Pos())
+			regex, err := regexp.Compile(pattern)
+			if err != nil {
+				diagnostics = append(diagnostics, parsing.Diagnostic{
+					File:     file,
+					Line:     position.Line,
+					Column:   position.Column,
+					Severity: parsing.SeverityError,
+					Message:  fmt.Sprintf("invalid step pattern %q: %v", pattern, err),
+				})
+				return true
+			}
+
+			defs = append(defs, Definition{
+				Pattern:  pattern,
+				File:     file,
+				Line:     position.Line,
+				Method:   selector.Sel.Name,
+				Function: handlerName(call.Args[1]),
+				regex:    regex,
+			})
+			return true
+		})
+	}
+	return defs, diagnostics, nil
+}
+
+// Extract the pattern from a string literal or a regexp.MustCompile("...") call
+func patternLiteral(expr ast.Expr) (string, bool) {
+	if call, ok := expr.(*ast.CallExpr); ok && len(call.Args) == 1 {
+		if selector, ok := call.Fun.(*ast.SelectorExpr); ok && (selector.Sel.Name == "MustCompile" || selector.Sel.Name == "Compile") {
+			expr = call.Args[0]
+		}
+	}
+	literal, ok := expr.(*ast.BasicLit)
+	if !ok || literal.Kind != token.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(literal.Value)
+	if err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// Describe the function bound to a step, e.g. "iHaveCukes" or "s.iPay"
+func handlerName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		if x, ok := e.X.(*ast.Ident); ok {
+			return x.Name + "." + e.Sel.Name
+		}
+		return e.Sel.Name
+	case *ast.FuncLit:
+		return "func literal"
+	}
+	return ""
+}
+
+// Match returns every definition whose pattern matches the step text, in registration order.
+// Definitions registered with Given, When or Then only match steps of that kind, as in godog.
+func (defs Definitions) Match(step parsing.Step) []*Definition {
+	var matches []*Definition
+	for i := range defs {
+		if kind, found := methodKinds[defs[i].Method]; found && step.Kind != kind {
+			continue
+		}
+		if defs[i].regex != nil && defs[i].regex.MatchString(step.Text) {
+			matches = append(matches, &defs[i])
+		}
+	}
+	return matches
+}
+
+// Bind maps every step of the tests to the definition godog would run for it.
+// Unmatched steps keep their text behind the Unbound prefix so they still compare by wording.
+func (defs Definitions) Bind(tests []parsing.Test) {
+	for i := range tests {
+		bound := make([]string, 0, len(tests[i].Source))
+		for _, step := range tests[i].Source {
+			if matches := defs.Match(step); len(matches) > 0 {
+				bound = append(bound, matches[0].Pattern) // godog runs the first registered match
+			} else {
+				bound = append(bound, Unbound+step.Text)
+			}
+		}
+		tests[i].Definitions = bound
+	}
+}
@@ -0,0 +1,160 @@
+package stepdefs
+
+import (
+	"encoding/json"
+	"go-similarity-reports/parsing"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const stepsSource = "package steps\n" +
+	"\n" +
+	"import (\n" +
+	"\t\"regexp\"\n" +
+	"\n" +
+	"\t\"github.com/cucumber/godog\"\n" +
+	")\n" +
+	"\n" +
+	"func InitializeScenario(ctx *godog.ScenarioContext) {\n" +
+	"\tctx.Step(`^I (?:am logged in|sign in) as \"([^\"]*)\"$`, iAmLoggedInAs)\n" +
+	"\tctx.Step(\"^I open the (\\\\w+) page$\", s.iOpenPage)\n" +
+	"\tctx.Then(regexp.MustCompile(`^I see the dashboard$`), func() error { return nil })\n" +
+	"\tctx.Step(`^broken(`, nothing)\n" +
+	"}\n"
+
+// Helper function to write step definition sources into a temporary directory
+func writeSources(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Error writing source file: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestScanDefinitions(t *testing.T) {
+	dir := writeSources(t, map[string]string{
+		"steps/steps_test.go": stepsSource,
+		"steps/broken.go":     "package steps\nfunc {",
+		"vendor/lib/steps.go": "package lib\nfunc f(ctx C) { ctx.Step(`^vendored$`, f) }",
+		"steps/unrelated.go":  "package steps\nfunc g(r R) { r.Step(1, 2, 3) }",
+		"features/a.feature":  "Feature: ignored",
+	})
+
+	defs, diagnostics, err := ScanDefinitions(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var patterns []string
+	for _, def := range defs {
+		patterns = append(patterns, def.Pattern)
+	}
+	expected := []string{`^I (?:am logged in|sign in) as "([^"]*)"$`, `^I open the (\w+) page$`, `^I see the dashboard$`}
+	if !reflect.DeepEqual(patterns, expected) {
+		t.Fatalf("Expected %v, got %v", expected, patterns)
+	}
+	if defs[0].File != "steps/steps_test.go" || defs[0].Line != 10 || defs[0].Function != "iAmLoggedInAs" {
+		t.Errorf("Unexpected definition location: %+v", defs[0])
+	}
+	if defs[1].Function != "s.iOpenPage" || defs[2].Method != "Then" {
+		t.Errorf("Unexpected definition handlers: %+v", defs[1:])
+	}
+
+	// One diagnostic for the Go syntax error, one for the invalid pattern
+	if len(diagnostics) != 2 {
+		t.Errorf("Expected 2 diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestBind(t *testing.T) {
+	dir := writeSources(t, map[string]string{"steps_test.go": stepsSource})
+	defs, _, err := ScanDefinitions(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	first, _ := parsing.ParseFeature(strings.NewReader("Feature: A\n  Scenario: A\n    Given I am logged in as \"admin\"\n    When I open the orders page\n"), "a.feature")
+	second, _ := parsing.ParseFeature(strings.NewReader("Feature: B\n  Scenario: B\n    Given I sign in as \"guest\"\n    When I open the invoices page\n    Then I fly away\n"), "b.feature")
+	tests := parsing.BuildTests([]parsing.Feature{*first, *second}, parsing.TestOptions{Granularity: parsing.GranularityScenario})
+
+	defs.Bind(tests)
+	if !reflect.DeepEqual(tests[0].Definitions, tests[1].Definitions[:2]) {
+		t.Errorf("Expected differently worded steps to bind to the same definitions:\n%v\n%v", tests[0].Definitions, tests[1].Definitions)
+	}
+	if tests[1].Definitions[2] != Unbound+"I fly away" {
+		t.Errorf("Expected unmatched step to stay unbound, got %q", tests[1].Definitions[2])
+	}
+
+	// A ctx.Then definition only binds outcome steps, And steps included
+	third, _ := parsing.ParseFeature(strings.NewReader("Feature: C\n  Scenario: C\n    When I see the dashboard\n    Then I open the orders page\n    And I see the dashboard\n"), "c.feature")
+	tests = parsing.BuildTests([]parsing.Feature{*third}, parsing.TestOptions{Granularity: parsing.GranularityScenario})
+	defs.Bind(tests)
+	expected := []string{Unbound + "I see the dashboard", `^I open the (\w+) page$`, `^I see the dashboard$`}
+	if !reflect.DeepEqual(tests[0].Definitions, expected) {
+		t.Errorf("Expected %v, got %v", expected, tests[0].Definitions)
+	}
+}
+
+func TestGetStepDefinitionReport(t *testing.T) {
+	sources := writeSources(t, map[string]string{
+		"steps_test.go": stepsSource,
+		"extra.go":      "package steps\nfunc more(ctx C) {\n\tctx.Step(`^I open the orders page$`, orders)\n\tctx.Step(`^nobody uses this$`, unused)\n}\n",
+	})
+	features := writeSources(t, map[string]string{
+		"orders/orders.feature": "Feature: Orders\n" +
+			"  Scenario Outline: Open a page\n" +
+			"    Given I sign in as \"<user>\"\n" +
+			"    When I open the orders page\n" +
+			"    Then I fly away\n" +
+			"\n" +
+			"    Examples:\n" +
+			"      | user  |\n" +
+			"      | admin |\n" +
+			"      | guest |\n",
+	})
+
+	req := httptest.NewRequest("GET", "/api/step-definitions/report?strict=true&directory="+url.QueryEscape(features)+"&step_definitions="+url.QueryEscape(sources), nil)
+	rr := httptest.NewRecorder()
+	GetStepDefinitionReport(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code 422 in strict mode, got %d", rr.Code)
+	}
+
+	var report Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// The outline step is checked per row but reported once
+	if len(report.Undefined) != 1 || report.Undefined[0].Text != "I fly away" || report.Undefined[0].Line != 5 || report.Undefined[0].File != "orders/orders.feature" {
+		t.Errorf("Unexpected undefined steps: %+v", report.Undefined)
+	}
+	if len(report.Ambiguous) != 1 || len(report.Ambiguous[0].Definitions) != 2 || report.Ambiguous[0].Step.Line != 4 {
+		t.Errorf("Unexpected ambiguous steps: %+v", report.Ambiguous)
+	}
+
+	unused := map[string]bool{}
+	for _, def := range report.Unused {
+		unused[def.Pattern] = true
+	}
+	if !unused[`^nobody uses this$`] || !unused[`^I see the dashboard$`] || unused[`^I open the (\w+) page$`] {
+		t.Errorf("Unexpected unused definitions: %+v", report.Unused)
+	}
+	if report.OK {
+		t.Error("Expected report not to be ok")
+	}
+}
@@ -7,8 +7,9 @@ import (
 )
 
 type JourneyNode struct {
-	Name     string        `json:"name"`
-	Children []JourneyNode `json:"children,omitempty"`
+	Name        string               `json:"name"`
+	Children    []JourneyNode        `json:"children,omitempty"`
+	Diagnostics []parsing.Diagnostic `json:"diagnostics,omitempty"` // Only set on the root node
 }
 
 // Function to merge identical nodes in the test journeys
@@ -44,7 +45,7 @@ func GetMergedTestJourneys(w http.ResponseWriter, r *http.Request) {
 		dir = "./tdata" // Default path
 	}
 
-	tests, err := parsing.ParseFeatureFiles(dir)
+	tests, diagnostics, err := parsing.ParseFeatureFiles(dir, parsing.WalkOptionsFromQuery(r.URL.Query()))
 	if err != nil {
 		http.Error(w, "Error parsing tests: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -55,11 +56,13 @@ func GetMergedTestJourneys(w http.ResponseWriter, r *http.Request) {
 
 	// Prepare response with the merged test journeys
 	response := struct {
-		Name     string          `json:"name"`
-		Children []*parsing.Test `json:"children"`
+		Name        string               `json:"name"`
+		Children    []*parsing.Test      `json:"children"`
+		Diagnostics []parsing.Diagnostic `json:"diagnostics"`
 	}{
-		Name:     "Merged Test Journeys",
-		Children: mergedTests,
+		Name:        "Merged Test Journeys",
+		Children:    mergedTests,
+		Diagnostics: diagnostics,
 	}
 
 	// Set header and return JSON response
@@ -88,13 +91,14 @@ func GetTestJourneys(w http.ResponseWriter, r *http.Request) {
 		dir = "./tdata" // Default path
 	}
 
-	tests, err := parsing.ParseFeatureFiles(dir)
+	tests, diagnostics, err := parsing.ParseFeatureFiles(dir, parsing.WalkOptionsFromQuery(r.URL.Query()))
 	if err != nil {
 		http.Error(w, "Error parsing tests: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	testJourneys := generateTestJourneys(tests)
+	testJourneys.Diagnostics = diagnostics
 
 	// Set header and return JSON response
 	w.Header().Set("Content-Type", "application/json")